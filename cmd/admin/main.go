@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/noelukwa/git-explorer/internal/pkg/config"
+	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
+)
+
+const usage = `usage: admin dlq <command> [-limit n] <queue>
+
+commands:
+  inspect   print the dead letters of queue as JSON, leaving them in place
+  replay    move the dead letters of queue back onto it
+`
+
+func main() {
+	var cfg config.AdminConfig
+
+	err := envconfig.Process("admin", &cfg)
+	if err != nil {
+		log.Fatalf("failed to process config: %v", err)
+	}
+
+	if len(os.Args) < 3 || os.Args[1] != "dlq" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[2]
+
+	flags := flag.NewFlagSet("dlq "+command, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	limit := flags.Int("limit", 100, "maximum number of dead letters to handle")
+	flags.Parse(os.Args[3:])
+	if flags.NArg() != 1 || *limit < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	queue := flags.Arg(0)
+
+	// The in-memory broker lives inside another process, there is nothing
+	// to connect to from here.
+	if cfg.MessagingProvider == messaging.ProviderInMemory {
+		log.Fatalf("the %s messaging provider cannot be administered remotely", cfg.MessagingProvider)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	mc, err := messaging.New(cfg.MessagingProvider, cfg.MessagingURL)
+	if err != nil {
+		log.Fatalf("failed to connect to messaging system: %v", err)
+	}
+	defer mc.Close()
+
+	switch command {
+	case "inspect":
+		letters, err := mc.DeadLetters(ctx, queue, *limit)
+		if err != nil {
+			log.Fatalf("failed to inspect dead letters of %s: %v", queue, err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(letters); err != nil {
+			log.Fatalf("failed to print dead letters: %v", err)
+		}
+
+	case "replay":
+		n, err := mc.Replay(ctx, queue, *limit)
+		if err != nil {
+			log.Fatalf("failed to replay dead letters of %s after %d: %v", queue, n, err)
+		}
+		log.Printf("replayed %d dead letters onto %s", n, queue)
+
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
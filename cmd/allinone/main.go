@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorer/api"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+	inmem "github.com/noelukwa/git-explorer/internal/explorer/repository/in-mem"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository/postgres"
+	explorer "github.com/noelukwa/git-explorer/internal/explorer/service"
+	"github.com/noelukwa/git-explorer/internal/explorerd/cursor"
+	explorerd "github.com/noelukwa/git-explorer/internal/explorerd/service"
+	"github.com/noelukwa/git-explorer/internal/pkg/config"
+	"github.com/noelukwa/git-explorer/internal/pkg/github"
+	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
+)
+
+// allinone runs the explorer API and the explorerd worker in one process.
+func main() {
+	var cfg config.AllInOneConfig
+
+	err := envconfig.Process("allinone", &cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	policy := retry.NewPolicy(cfg.MaxRetries, cfg.BackoffInitial, cfg.BackoffMax)
+
+	mc, err := messaging.New(cfg.MessagingProvider, cfg.MessagingURL, messaging.WithRetry(policy), messaging.WithMaxDeliveries(cfg.MaxDeliveries))
+	if err != nil {
+		log.Fatalf("failed to connect to messaging system: %v", err)
+	}
+	defer mc.Close()
+
+	for _, queue := range []string{events.DataQueue, events.IntentsQueue} {
+		if err := mc.DeclareQueue(queue); err != nil {
+			log.Fatalf("unable to declare %s queue: %v\n", queue, err)
+		}
+	}
+
+	store, closeStore, err := openStore(ctx, cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer closeStore()
+
+	relay := explorer.NewOutboxRelay(store.OutboxRepository(), mc, cfg.OutboxInterval, explorer.WithMaxAttempts(cfg.OutboxMaxAttempts))
+	intentService := explorer.NewIntentService(store.IntentRepository(), relay)
+	repoService := explorer.NewRemoteRepoService(store.RemoteRepository())
+
+	gc := github.NewClient(cfg.GithubToken, github.WithRetry(policy), github.WithTimeout(cfg.GithubTimeout))
+
+	var workerOpts []explorerd.Option
+	if cfg.CommitStats {
+		workerOpts = append(workerOpts, explorerd.WithCommitStats())
+	}
+	worker := explorerd.NewService(cfg.MonitoringInterval, cfg.BatchSize, gc, mc, cursor.NewMemoryStore(), workerOpts...)
+
+	httpServer := &http.Server{
+		Handler: api.SetupRoutes(intentService, repoService),
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+	}
+
+	shutdownSignals := make(chan os.Signal, 1)
+	signal.Notify(shutdownSignals, syscall.SIGINT, syscall.SIGTERM)
+
+	serverErrors := make(chan error, 4)
+
+	go func() {
+		log.Printf("starting HTTP server on %d", cfg.Port)
+		serverErrors <- httpServer.ListenAndServe()
+	}()
+
+	if err := mc.Subscribe(ctx, events.DataQueue, repoService.Process); err != nil {
+		log.Fatalln(err)
+	}
+	if err := mc.Subscribe(ctx, events.IntentsQueue, worker.Process); err != nil {
+		log.Fatalln(err)
+	}
+
+	go func() {
+		if err := relay.Run(ctx); err != nil && err != context.Canceled {
+			serverErrors <- err
+		}
+	}()
+
+	pruner := explorer.NewEventPruner(store.RemoteRepository(), cfg.EventRetention)
+	go func() {
+		if err := pruner.Run(ctx); err != nil && err != context.Canceled {
+			serverErrors <- err
+		}
+	}()
+
+	go func() {
+		if err := worker.Start(ctx); err != nil && err != context.Canceled {
+			serverErrors <- err
+		}
+	}()
+
+	select {
+	case sig := <-shutdownSignals:
+		log.Printf("received termination signal: %s", sig.String())
+	case err := <-serverErrors:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Fatalf("server shutdown error: %v", err)
+	}
+}
+
+// openStore returns the repositories selected by cfg.Store and a function
+// releasing them.
+func openStore(ctx context.Context, cfg config.AllInOneConfig) (repository.RepositoryFactory, func(), error) {
+	switch cfg.Store {
+	case "inmem":
+		return inmem.NewRepositoryFactory(), func() {}, nil
+	case "postgres":
+		pool, err := postgres.NewPool(ctx, cfg.DatabaseURL, postgres.PoolConfig{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to connect to database: %w", err)
+		}
+		store, err := postgres.NewStore(pool)
+		if err != nil {
+			pool.Close()
+			return nil, nil, err
+		}
+		return store, pool.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown store %q, expected inmem or postgres", cfg.Store)
+	}
+}
@@ -7,10 +7,10 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/noelukwa/git-explorer/internal/events"
@@ -19,6 +19,7 @@ import (
 	"github.com/noelukwa/git-explorer/internal/explorer/service"
 	"github.com/noelukwa/git-explorer/internal/pkg/config"
 	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
 )
 
 func main() {
@@ -29,38 +30,50 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mc, err := messaging.NewClient(cfg.MessagingURL)
+	policy := retry.NewPolicy(cfg.MaxRetries, cfg.BackoffInitial, cfg.BackoffMax)
+
+	mc, err := messaging.New(cfg.MessagingProvider, cfg.MessagingURL, messaging.WithRetry(policy), messaging.WithMaxDeliveries(cfg.MaxDeliveries))
 	if err != nil {
 		log.Fatalf("failed to connect to messaging system: %v", err)
 	}
 	defer mc.Close()
 
-	err = mc.DeclareQueue("gitexpress")
+	err = mc.DeclareQueue(events.DataQueue)
 	if err != nil {
 		log.Fatalf("unable to declare gitexpress queue: %v\n", err)
 	}
 
-	err = mc.DeclareQueue("gitintents")
+	err = mc.DeclareQueue(events.IntentsQueue)
 	if err != nil {
 		log.Fatalf("unable to declare gitintents queue: %v\n", err)
 	}
 
-	conn, err := pgx.Connect(context.Background(), cfg.DatabaseURL)
+	pool, err := postgres.NewPool(ctx, cfg.DatabaseURL, postgres.PoolConfig{
+		MaxConns:          cfg.DatabaseMaxConns,
+		MinConns:          cfg.DatabaseMinConns,
+		MaxConnLifetime:   cfg.DatabaseMaxConnLifetime,
+		MaxConnIdleTime:   cfg.DatabaseMaxConnIdleTime,
+		HealthCheckPeriod: cfg.DatabaseHealthCheckPeriod,
+		ConnectTimeout:    cfg.DatabaseConnectTimeout,
+	})
 	if err != nil {
 		log.Fatalf("unable to connect to database: %v\n", err)
 	}
-	defer conn.Close(context.Background())
+	defer pool.Close()
 
-	pgStore, err := postgres.NewStore(conn)
+	pgStore, err := postgres.NewStore(pool)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
+	relay := service.NewOutboxRelay(pgStore.OutboxRepository(), mc, cfg.OutboxInterval, service.WithMaxAttempts(cfg.OutboxMaxAttempts))
+
 	intentService := service.NewIntentService(
 		pgStore.IntentRepository(),
+		relay,
 	)
 
 	repoService := service.NewRemoteRepoService(
@@ -77,37 +90,40 @@ func main() {
 	shutdownSignals := make(chan os.Signal, 1)
 	signal.Notify(shutdownSignals, syscall.SIGINT, syscall.SIGTERM)
 
-	serverErrors := make(chan error, 1)
+	serverErrors := make(chan error, 4)
 
 	go func() {
 		log.Printf("starting HTTP server on %d", cfg.Port)
 		serverErrors <- httpServer.ListenAndServe()
 	}()
 
+	// On shutdown the background work is stopped and waited for, and the
+	// broker closed, so that none of it is left using the pool once it is
+	// closed.
+	var background sync.WaitGroup
+
+	background.Add(1)
 	go func() {
-		if err := mc.Subscribe(ctx, "gitexpress", repoService.Process); err != nil {
+		defer background.Done()
+		if err := mc.Subscribe(ctx, events.DataQueue, repoService.Process); err != nil {
 			serverErrors <- err
 		}
 	}()
 
-	// Producer: Publish to gitintents
+	background.Add(1)
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				message := fmt.Sprintf("Intent message at %s", time.Now().UTC())
-				err := mc.Publish(ctx, "gitintents", events.NEW_REPO_INTENT, []byte(message))
-				if err != nil {
-					log.Printf("Failed to publish to gitintents: %v", err)
-				} else {
-					log.Printf("Published to gitintents: %s", message)
-				}
-			case <-ctx.Done():
-				return
-			}
+		defer background.Done()
+		if err := relay.Run(ctx); err != nil && err != context.Canceled {
+			serverErrors <- err
+		}
+	}()
+
+	pruner := service.NewEventPruner(pgStore.RemoteRepository(), cfg.EventRetention)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		if err := pruner.Run(ctx); err != nil && err != context.Canceled {
+			serverErrors <- err
 		}
 	}()
 
@@ -119,11 +135,14 @@ func main() {
 			log.Fatalf("server error: %v", err)
 		}
 	}
+	cancel()
+	background.Wait()
+	mc.Close()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 3*time.Minute)
 	defer shutdownCancel()
 
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		log.Fatalf("server shutdown error: %v", err)
+		log.Printf("server shutdown error: %v", err)
 	}
 }
@@ -5,26 +5,19 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
-	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorerd/cursor"
 	"github.com/noelukwa/git-explorer/internal/explorerd/service"
 	"github.com/noelukwa/git-explorer/internal/pkg/config"
 	"github.com/noelukwa/git-explorer/internal/pkg/github"
 	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
 )
 
-type RepositoryIntent struct {
-	Repo        string    `json:"repo"`
-	Since       time.Time `json:"since"`
-	Until       time.Time `json:"until"`
-	LastFetched time.Time `json:"last_fetched"`
-}
-
 func main() {
 	var cfg config.ExplorerdConfig
 
@@ -35,56 +28,62 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mc, err := messaging.NewClient(cfg.MessagingURL)
+	policy := retry.NewPolicy(cfg.MaxRetries, cfg.BackoffInitial, cfg.BackoffMax)
+
+	mc, err := messaging.New(cfg.MessagingProvider, cfg.MessagingURL, messaging.WithRetry(policy), messaging.WithMaxDeliveries(cfg.MaxDeliveries))
 	if err != nil {
 		log.Fatalf("Failed to connect to messaging system: %v", err)
 	}
 	defer mc.Close()
 
-	err = mc.DeclareQueue("gitexpress")
+	err = mc.DeclareQueue(events.DataQueue)
 	if err != nil {
 		log.Fatalf("Failed to declare gitexpress queue: %v", err)
 	}
 
-	err = mc.DeclareQueue("gitintents")
+	err = mc.DeclareQueue(events.IntentsQueue)
 	if err != nil {
 		log.Fatalf("Failed to declare gitintents queue: %v", err)
 	}
 
-	gc := github.NewClient(cfg.GithubToken)
-	_ = service.NewService(cfg.MonitoringInterval, gc)
+	var cursors cursor.Store = cursor.NewMemoryStore()
+	if cfg.CursorFile != "" {
+		cursors, err = cursor.NewFileStore(cfg.CursorFile)
+		if err != nil {
+			log.Fatalf("Failed to open cursor store: %v", err)
+		}
+	}
+
+	githubOpts := []github.Option{
+		github.WithRetry(policy),
+		github.WithTimeout(cfg.GithubTimeout),
+	}
+	if cfg.GithubCacheDir != "" {
+		cache, err := github.NewDiskCache(cfg.GithubCacheDir)
+		if err != nil {
+			log.Fatalf("Failed to open github cache: %v", err)
+		}
+		githubOpts = append(githubOpts, github.WithCache(cache))
+	}
+
+	gc := github.NewClient(cfg.GithubToken, githubOpts...)
+
+	var serviceOpts []service.Option
+	if cfg.CommitStats {
+		serviceOpts = append(serviceOpts, service.WithCommitStats())
+	}
+	svc := service.NewService(cfg.MonitoringInterval, cfg.BatchSize, gc, mc, cursors, serviceOpts...)
 
 	errChan := make(chan error, 2)
 
-	// Producer
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-
-		id := 1
-		for {
-			select {
-			case <-ticker.C:
-				message := "hello " + " " + time.Now().UTC().String() + " id " + strconv.Itoa(id)
-				err = mc.Publish(ctx, "gitexpress", events.NEW_REPO_INTENT, message)
-				if err != nil {
-					log.Printf("Failed to publish message: %s", err)
-				}
-				log.Printf("Published message to gitexpress: %s", message)
-				id++
-			case <-ctx.Done():
-				return
-			}
+		if err := svc.Start(ctx); err != nil && err != context.Canceled {
+			errChan <- err
 		}
 	}()
 
-	// Consumer
 	go func() {
-		err := mc.Subscribe(ctx, "gitintents", func(ctx context.Context, ek events.EventKind, b []byte) {
-			log.Printf("Received message from gitintents: EventKind=%s, Body=%s", ek, string(b))
-			// Process the message here
-		})
-		if err != nil {
+		if err := mc.Subscribe(ctx, events.IntentsQueue, svc.Process); err != nil {
 			errChan <- err
 		}
 	}()
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the envelope version this build produces. Consumers
+// reject any other version instead of guessing at its layout.
+const SchemaVersion = 1
+
+// Producers stamped on the envelopes of each service.
+const (
+	ProducerExplorer  = "explorer"
+	ProducerExplorerd = "explorerd"
+)
+
+var (
+	ErrMalformedEnvelope  = errors.New("malformed event envelope")
+	ErrMalformedData      = errors.New("malformed event data")
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+)
+
+// Envelope wraps every event put on a queue. CorrelationID is shared by an
+// event and everything produced while handling it, down the chain, and is
+// the ID of the first event of the chain. TraceID carries the ID of the
+// request that started the chain, when there was one.
+type Envelope struct {
+	ID            uuid.UUID       `json:"id"`
+	Kind          EventKind       `json:"kind"`
+	Version       int             `json:"version"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Producer      string          `json:"producer"`
+	CorrelationID uuid.UUID       `json:"correlation_id"`
+	TraceID       string          `json:"trace_id,omitempty"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// NewEnvelope wraps data, encoded as JSON, as an event of kind. An event
+// produced while handling another one, see WithCause, joins its correlation;
+// any other starts a new one.
+func NewEnvelope(ctx context.Context, producer string, kind EventKind, data interface{}) (*Envelope, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling %s event: %w", kind, err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	env := &Envelope{
+		ID:            id,
+		Kind:          kind,
+		Version:       SchemaVersion,
+		ProducedAt:    time.Now().UTC(),
+		Producer:      producer,
+		CorrelationID: id,
+		TraceID:       traceFrom(ctx),
+		Data:          body,
+	}
+	if cause, ok := ctx.Value(causeKey{}).(*Envelope); ok {
+		env.CorrelationID = cause.CorrelationID
+		env.TraceID = cause.TraceID
+	}
+	return env, nil
+}
+
+// Decode reads an envelope off the wire, rejecting versions this build does
+// not know with ErrUnsupportedVersion.
+func Decode(body []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEnvelope, err)
+	}
+	if env.Version != SchemaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, env.Version)
+	}
+	if env.ID == uuid.Nil || env.Kind == "" {
+		return nil, fmt.Errorf("%w: missing id or kind", ErrMalformedEnvelope)
+	}
+	return &env, nil
+}
+
+// Unmarshal decodes the event data into v. Failures wrap ErrMalformedData,
+// which brokers dead-letter without retrying.
+func (e *Envelope) Unmarshal(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedData, err)
+	}
+	return nil
+}
+
+type causeKey struct{}
+
+type traceKey struct{}
+
+// WithCause marks ctx as handling env, so that events produced with it join
+// the correlation of env.
+func WithCause(ctx context.Context, env *Envelope) context.Context {
+	return context.WithValue(ctx, causeKey{}, env)
+}
+
+// WithTrace sets the trace ID of the events produced with ctx when they do
+// not join an existing correlation.
+func WithTrace(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+func traceFrom(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceKey{}).(string)
+	return traceID
+}
@@ -0,0 +1,54 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	ctx := events.WithTrace(context.Background(), "request-1")
+	env, err := events.NewEnvelope(ctx, events.ProducerExplorer, events.NEW_REPO_INTENT, events.RepoIntentPausedEvent{Repository: "test/repo"})
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, env.CorrelationID)
+	assert.Equal(t, "request-1", env.TraceID)
+
+	body, err := json.Marshal(env)
+	require.NoError(t, err)
+	decoded, err := events.Decode(body)
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, decoded.ID)
+	assert.Equal(t, events.SchemaVersion, decoded.Version)
+
+	var data events.RepoIntentPausedEvent
+	require.NoError(t, decoded.Unmarshal(&data))
+	assert.Equal(t, "test/repo", data.Repository)
+
+	// Events produced while handling it join its correlation.
+	child, err := events.NewEnvelope(events.WithCause(context.Background(), decoded), events.ProducerExplorerd, events.NEW_REPO_DATA, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, env.ID, child.ID)
+	assert.Equal(t, env.CorrelationID, child.CorrelationID)
+	assert.Equal(t, "request-1", child.TraceID)
+}
+
+func TestDecode_Rejects(t *testing.T) {
+	for name, body := range map[string]string{
+		"not json":       `{`,
+		"bare event":     `{"repository":"test/repo"}`,
+		"future version": `{"id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","kind":"NEW_INTENT","version":2,"data":{}}`,
+		"missing id":     `{"kind":"NEW_INTENT","version":1,"data":{}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := events.Decode([]byte(body))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := events.Decode([]byte(`{"id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","kind":"NEW_INTENT","version":2}`))
+	assert.ErrorIs(t, err, events.ErrUnsupportedVersion)
+}
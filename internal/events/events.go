@@ -6,13 +6,21 @@ import (
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 )
 
+// Queues shared by explorer and explorerd. Intents flow from explorer to
+// explorerd on IntentsQueue, collected data flows back on DataQueue.
+const (
+	IntentsQueue = "gitintents"
+	DataQueue    = "gitexpress"
+)
+
 // EventKind represents the type of event.
 type EventKind string
 
 const (
-	NEW_REPO_INTENT  EventKind = "NEW_INTENT"
-	NEW_REPO_DATA    EventKind = "NEW_REPO_DATA"
-	NEW_COMMITS_DATA EventKind = "NEW_COMMITS_DATA"
+	NEW_REPO_INTENT    EventKind = "NEW_INTENT"
+	REPO_INTENT_PAUSED EventKind = "INTENT_PAUSED"
+	NEW_REPO_DATA      EventKind = "NEW_REPO_DATA"
+	NEW_COMMITS_DATA   EventKind = "NEW_COMMITS_DATA"
 )
 
 type NewRepoIntentEvent struct {
@@ -20,6 +28,10 @@ type NewRepoIntentEvent struct {
 	Since      time.Time `json:"since"`
 }
 
+type RepoIntentPausedEvent struct {
+	Repository string `json:"repository"`
+}
+
 type NewRepoDataEvent struct {
 	Info *models.Repository `json:"info"`
 }
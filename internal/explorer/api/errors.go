@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 error body.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorHandler turns every error returned by a handler into a problem+json
+// response. Repository errors map to 404, 409 and 422, failed validation to
+// 422, and anything unexpected is logged and reported as a bare 500.
+func errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	status, detail := classify(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("request %s: %s %s: %v", requestID, c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request().URL.Path,
+		RequestID: requestID,
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, mimeProblemJSON)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, problem)
+	}
+	if err != nil {
+		log.Printf("request %s: failed to write error response: %v", requestID, err)
+	}
+}
+
+func classify(err error) (int, string) {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code, fmt.Sprint(httpErr.Message)
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return http.StatusUnprocessableEntity, validationErrs.Error()
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, repository.ErrInvalid):
+		return http.StatusUnprocessableEntity, err.Error()
+	}
+	return http.StatusInternalServerError, "an unexpected error occurred"
+}
@@ -0,0 +1,63 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/noelukwa/git-explorer/internal/explorer/api"
+	inmem "github.com/noelukwa/git-explorer/internal/explorer/repository/in-mem"
+	"github.com/noelukwa/git-explorer/internal/explorer/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponses(t *testing.T) {
+	factory := inmem.NewRepositoryFactory()
+	e := api.SetupRoutes(
+		service.NewIntentService(factory.IntentRepository(), nil),
+		service.NewRemoteRepoService(factory.RemoteRepository()),
+	)
+
+	do := func(method, target, body string) (*httptest.ResponseRecorder, api.Problem) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var problem api.Problem
+		if rec.Code >= 400 {
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		}
+		return rec, problem
+	}
+
+	rec, problem := do(http.MethodGet, "/repos/test/missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, "/repos/test/missing", problem.Instance)
+	assert.NotEmpty(t, problem.RequestID)
+	assert.Equal(t, rec.Header().Get("X-Request-Id"), problem.RequestID)
+
+	rec, _ = do(http.MethodGet, "/intents/6b0b8f3e-7c53-4c1c-9d51-3c2a4f0b6d7e", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec, _ = do(http.MethodPost, "/intents", `{"repo": "test/repo", "since": "2024-01-01"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec, problem = do(http.MethodPost, "/intents", `{"repo": "test/repo", "since": "2024-01-01"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, problem.Detail, "already booked")
+
+	rec, _ = do(http.MethodPost, "/intents", `{"repo": "test", "since": "2024-01-01"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec, _ = do(http.MethodPost, "/intents", `{"since": "2024-01-01"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec, _ = do(http.MethodPost, "/intents", `{`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"errors"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -47,11 +45,11 @@ type AddIntentRequest struct {
 func (h *IntentHandler) AddIntent(c echo.Context) error {
 	var request AddIntentRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
 	}
 
 	if err := h.validator.Struct(request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
 
 	intent, err := h.intentService.CreateIntent(
@@ -60,18 +58,14 @@ func (h *IntentHandler) AddIntent(c echo.Context) error {
 		time.Time(request.Since),
 	)
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidRepository) || errors.Is(err, service.ErrExistingIntent) {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-		}
-		log.Printf("error: %s", err.Error())
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to add intent"})
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, intent)
 }
 
 type UpdateIntentRequest struct {
-	IsActive bool  `json:"is_active"`
+	IsActive *bool `json:"is_active"`
 	Since    Since `json:"since"`
 }
 
@@ -79,16 +73,16 @@ func (h *IntentHandler) UpdateIntent(c echo.Context) error {
 	idParam := c.Param("id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid intent ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid intent ID")
 	}
 
 	var request UpdateIntentRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body!!"})
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
 	}
 
 	if err := h.validator.Struct(request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
 
 	since := time.Time(request.Since)
@@ -100,7 +94,7 @@ func (h *IntentHandler) UpdateIntent(c echo.Context) error {
 
 	intent, err := h.intentService.UpdateIntent(c.Request().Context(), intentUpdate)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update intent"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, intent)
@@ -110,12 +104,12 @@ func (h *IntentHandler) FetchIntent(c echo.Context) error {
 	idParam := c.Param("id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid intent ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid intent ID")
 	}
 
 	intent, err := h.intentService.GetIntentById(c.Request().Context(), id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update intent"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, intent)
@@ -129,14 +123,14 @@ func (h *IntentHandler) FetchIntents(c echo.Context) error {
 	if flag != "" {
 		boolValue, err := strconv.ParseBool(flag)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid is_active parameter"})
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid is_active parameter")
 		}
 		isActive = boolValue
 	}
 
 	intents, err := h.intentService.GetIntents(c.Request().Context(), isActive)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch intents"})
+		return err
 	}
 	return c.JSON(http.StatusOK, intents)
 }
@@ -2,16 +2,42 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 	"github.com/noelukwa/git-explorer/internal/explorer/service"
 )
 
+// Date is a query parameter that accepts either a day or a full RFC 3339
+// timestamp.
+type Date time.Time
+
+func (d *Date) UnmarshalParam(param string) error {
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", param)
+		if err != nil {
+			return err
+		}
+	}
+	*d = Date(t)
+	return nil
+}
+
+func (d Date) ptr() *time.Time {
+	t := time.Time(d)
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 type RemoteHandler struct {
 	remoteService service.RemoteRepoService
 	validator     *validator.Validate
+	binder        echo.DefaultBinder
 }
 
 func NewRemoteRepositoryHandler(remoteService service.RemoteRepoService) *RemoteHandler {
@@ -21,29 +47,163 @@ func NewRemoteRepositoryHandler(remoteService service.RemoteRepoService) *Remote
 	}
 }
 
+type TopCommittersRequest struct {
+	StartDate Date `query:"start_date"`
+	EndDate   Date `query:"end_date"`
+	Page      int  `query:"page" validate:"min=1"`
+	PerPage   int  `query:"per_page" validate:"min=1,max=100"`
+}
+
 func (h *RemoteHandler) FetchTopCommitters(c echo.Context) error {
-	limitStr := c.QueryParam("limit")
-	repo := c.QueryParam("repo")
+	request := TopCommittersRequest{Page: 1, PerPage: 10}
+	if err := h.binder.BindQueryParams(c, &request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query parameters")
+	}
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		// If the limit is not a valid integer, return a bad request error
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit parameter"})
+	if err := h.validator.Struct(request); err != nil {
+		return err
 	}
 
-	committers, err := h.remoteService.GetTopCommitters(c.Request().Context(), repo, limit)
+	start, end := request.StartDate.ptr(), request.EndDate.ptr()
+	if start != nil && end != nil && end.Before(*start) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "end_date is before start_date")
+	}
+
+	committers, err := h.remoteService.GetTopCommitters(c.Request().Context(), repoName(c), start, end, request.Page, request.PerPage)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get top committers"})
+		return err
 	}
 	return c.JSON(http.StatusOK, committers)
 }
 
+type CommitsRequest struct {
+	StartDate Date   `query:"start_date"`
+	EndDate   Date   `query:"end_date"`
+	Author    string `query:"author" validate:"omitempty,max=39"`
+	Cursor    string `query:"cursor" validate:"omitempty,max=512"`
+	PerPage   int    `query:"per_page" validate:"min=1,max=100"`
+	WithTotal bool   `query:"with_total"`
+}
+
+func (h *RemoteHandler) FetchCommits(c echo.Context) error {
+	request := CommitsRequest{PerPage: 30}
+	if err := h.binder.BindQueryParams(c, &request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query parameters")
+	}
+
+	if err := h.validator.Struct(request); err != nil {
+		return err
+	}
+
+	start, end := request.StartDate.ptr(), request.EndDate.ptr()
+	if start != nil && end != nil && end.Before(*start) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "end_date is before start_date")
+	}
+
+	filter := repository.CommitsFilter{
+		RepositoryName: repoName(c),
+		StartDate:      start,
+		EndDate:        end,
+		Author:         request.Author,
+	}
+
+	commits, err := h.remoteService.GetCommits(c.Request().Context(), filter, request.Cursor, request.PerPage, request.WithTotal)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, commits)
+}
+
+type SearchCommitsRequest struct {
+	Query     string `query:"q" validate:"required,max=256"`
+	StartDate Date   `query:"start_date"`
+	EndDate   Date   `query:"end_date"`
+	Author    string `query:"author" validate:"omitempty,max=39"`
+	Page      int    `query:"page" validate:"min=1"`
+	PerPage   int    `query:"per_page" validate:"min=1,max=100"`
+}
+
+func (h *RemoteHandler) SearchCommits(c echo.Context) error {
+	request := SearchCommitsRequest{Page: 1, PerPage: 30}
+	if err := h.binder.BindQueryParams(c, &request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query parameters")
+	}
+
+	if err := h.validator.Struct(request); err != nil {
+		return err
+	}
+
+	start, end := request.StartDate.ptr(), request.EndDate.ptr()
+	if start != nil && end != nil && end.Before(*start) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "end_date is before start_date")
+	}
+
+	filter := repository.CommitsFilter{
+		RepositoryName: repoName(c),
+		StartDate:      start,
+		EndDate:        end,
+		Author:         request.Author,
+	}
+
+	matches, err := h.remoteService.SearchCommits(c.Request().Context(), request.Query, filter, request.Page, request.PerPage)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, matches)
+}
+
+type ActivityRequest struct {
+	StartDate Date   `query:"start_date"`
+	EndDate   Date   `query:"end_date"`
+	Interval  string `query:"interval" validate:"oneof=hour day week month"`
+	Timezone  string `query:"tz"`
+	GroupBy   string `query:"group_by" validate:"omitempty,oneof=author"`
+}
+
+func (h *RemoteHandler) FetchCommitActivity(c echo.Context) error {
+	request := ActivityRequest{Interval: "day", Timezone: "UTC"}
+	if err := h.binder.BindQueryParams(c, &request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query parameters")
+	}
+
+	if err := h.validator.Struct(request); err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(request.Timezone)
+	if err != nil || loc == time.Local {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "unknown timezone "+request.Timezone)
+	}
+
+	filter := repository.ActivityFilter{
+		RepositoryName: repoName(c),
+		StartDate:      request.StartDate.ptr(),
+		EndDate:        request.EndDate.ptr(),
+		Interval:       repository.Interval(request.Interval),
+		Location:       loc,
+		GroupBy:        []repository.GroupAbleCol{repository.CreatedAt},
+	}
+	if request.GroupBy == "author" {
+		filter.GroupBy = append(filter.GroupBy, repository.GroupByAuthor)
+	}
+
+	activity, err := h.remoteService.GetCommitActivity(c.Request().Context(), filter)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, activity)
+}
+
 func (h *RemoteHandler) FetchRepoInfo(c echo.Context) error {
-	repo := c.Param("name")
-	intent, err := h.remoteService.FindRepository(c.Request().Context(), repo)
+	repo, err := h.remoteService.FindRepository(c.Request().Context(), repoName(c))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update intent"})
+		return err
 	}
 
-	return c.JSON(http.StatusOK, intent)
+	return c.JSON(http.StatusOK, repo)
+}
+
+// repoName joins the owner and repo path parameters into a full name.
+func repoName(c echo.Context) string {
+	return c.Param("owner") + "/" + c.Param("repo")
 }
@@ -3,13 +3,22 @@ package api
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/api/handlers"
 	"github.com/noelukwa/git-explorer/internal/explorer/service"
 )
 
 func SetupRoutes(intentService service.IntentService, repoService service.RemoteRepoService) *echo.Echo {
 	e := echo.New()
+	e.HTTPErrorHandler = errorHandler
 
+	// The request ID traces the events a request produces.
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			req := c.Request()
+			c.SetRequest(req.WithContext(events.WithTrace(req.Context(), id)))
+		},
+	}))
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
@@ -29,6 +38,10 @@ func SetupRoutes(intentService service.IntentService, repoService service.Remote
 	e.GET("/intents", intentHandler.FetchIntents)
 
 	remoteRepoHandler := handlers.NewRemoteRepositoryHandler(repoService)
-	e.GET("/repos/:name", remoteRepoHandler.FetchRepoInfo)
+	e.GET("/repos/:owner/:repo", remoteRepoHandler.FetchRepoInfo)
+	e.GET("/repos/:owner/:repo/commits", remoteRepoHandler.FetchCommits)
+	e.GET("/repos/:owner/:repo/commits/search", remoteRepoHandler.SearchCommits)
+	e.GET("/repos/:owner/:repo/committers", remoteRepoHandler.FetchTopCommitters)
+	e.GET("/repos/:owner/:repo/activity", remoteRepoHandler.FetchCommitActivity)
 	return e
 }
@@ -15,8 +15,20 @@ type Intent struct {
 	IsActive   bool      `json:"is_active"`
 }
 
+// IntentUpdate changes the fields of an intent that are set, leaving the
+// others as they are.
 type IntentUpdate struct {
 	ID       uuid.UUID
-	IsActive bool       `json:"is_active"`
+	IsActive *bool      `json:"is_active"`
 	Since    *time.Time `json:"since"`
 }
+
+// Apply changes intent as the update asks. A zero Since is ignored.
+func (u *IntentUpdate) Apply(intent *Intent) {
+	if u.IsActive != nil {
+		intent.IsActive = *u.IsActive
+	}
+	if u.Since != nil && !u.Since.IsZero() {
+		intent.Since = *u.Since
+	}
+}
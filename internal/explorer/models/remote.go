@@ -17,14 +17,45 @@ type Repository struct {
 	Forks      int32     `json:"forks"`
 }
 
-// Commit represent the individual commits in the remote repository
+// Commit represent the individual commits in the remote repository.
+// CreatedAt is when the commit was committed, AuthoredAt when its change was
+// first written, which differ for rebased and cherry-picked commits.
 type Commit struct {
-	Hash      string    `json:"hash"`
-	Author    Author    `json:"author"`
-	Message   string    `json:"message"`
-	Url       *url.URL  `json:"url"`
-	CreatedAt time.Time `json:"created_at"`
-	Repository
+	Hash         string        `json:"hash"`
+	Author       Author        `json:"author"`
+	AuthoredAt   time.Time     `json:"authored_at"`
+	Committer    Author        `json:"committer"`
+	Message      string        `json:"message"`
+	Url          *url.URL      `json:"url"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Parents      []string      `json:"parents"`
+	Merge        bool          `json:"merge"`
+	Verification *Verification `json:"verification,omitempty"`
+	Stats        *CommitStats  `json:"stats,omitempty"`
+}
+
+// Verification is GitHub's verdict on the signature of a commit. Reason
+// explains it, such as "valid" or "unsigned".
+type Verification struct {
+	Verified bool   `json:"verified"`
+	Reason   string `json:"reason"`
+}
+
+// CommitStats is the size of the change made by a commit. It is only known
+// for commits fetched with their details.
+type CommitStats struct {
+	Additions    int `json:"additions"`
+	Deletions    int `json:"deletions"`
+	ChangedFiles int `json:"changed_files"`
+}
+
+// CommitMatch is a commit found by a message search. Highlight holds the
+// matching fragments of the message, HTML-escaped, with terms wrapped in
+// <mark> tags, so it is safe to render as HTML.
+type CommitMatch struct {
+	Commit
+	Rank      float32 `json:"rank"`
+	Highlight string  `json:"highlight"`
 }
 
 type Author struct {
@@ -35,13 +66,31 @@ type Author struct {
 }
 
 type AuthorStats struct {
-	Author  Author
-	Commits int64
+	Author  Author `json:"author"`
+	Commits int64  `json:"commits"`
+}
+
+// ActivityBucket counts the commits made in the interval starting at Start,
+// by Author when activity is split per author.
+type ActivityBucket struct {
+	Start   time.Time `json:"start"`
+	Author  *Author   `json:"author,omitempty"`
+	Commits int64     `json:"commits"`
 }
 
+// CommitPage is a keyset page of commits. Next and Prev are opaque cursors
+// for the neighbouring pages, empty when there is none.
 type CommitPage struct {
-	Commits    []Commit
-	TotalCount int64
-	Page       int32
-	PerPage    int32
+	Commits    []Commit `json:"commits"`
+	TotalCount *int64   `json:"total_count,omitempty"`
+	PerPage    int32    `json:"per_page"`
+	Next       string   `json:"next,omitempty"`
+	Prev       string   `json:"prev,omitempty"`
+}
+
+type CommitMatchPage struct {
+	Matches    []CommitMatch `json:"matches"`
+	TotalCount int64         `json:"total_count"`
+	Page       int32         `json:"page"`
+	PerPage    int32         `json:"per_page"`
 }
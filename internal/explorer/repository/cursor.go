@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Cursor is a position in a listing ordered by (created_at, hash), newest
+// first. Backward cursors read towards newer rows, forward ones towards
+// older rows.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	Hash      string    `json:"h"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+// Encode returns the opaque form of c handed out to API clients.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor made by Encode.
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalid)
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.CreatedAt.IsZero() || c.Hash == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalid)
+	}
+	return &c, nil
+}
+
+// KeysetPage builds a page out of rows fetched after cursor, in the
+// direction of the cursor and with one row more than the page size so it is
+// known whether more follow. It restores newest-first order and sets the
+// cursors of the neighbouring pages.
+func KeysetPage[T any](rows []T, perPage int, cursor *Cursor, key func(T) (time.Time, string)) PaginatedResponse[T] {
+	more := len(rows) > perPage
+	if more {
+		rows = rows[:perPage]
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		slices.Reverse(rows)
+	}
+
+	page := PaginatedResponse[T]{
+		Data:    rows,
+		PerPage: perPage,
+	}
+	if len(rows) == 0 {
+		return page
+	}
+
+	if more || backward {
+		createdAt, hash := key(rows[len(rows)-1])
+		page.Next = Cursor{CreatedAt: createdAt, Hash: hash}.Encode()
+	}
+	if (more && backward) || (cursor != nil && !backward) {
+		createdAt, hash := key(rows[0])
+		page.Prev = Cursor{CreatedAt: createdAt, Hash: hash, Backward: true}.Encode()
+	}
+	return page
+}
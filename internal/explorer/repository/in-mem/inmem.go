@@ -2,16 +2,29 @@ package inmem
 
 import "github.com/noelukwa/git-explorer/internal/explorer/repository"
 
-type repositoryFactory struct{}
+type repositoryFactory struct {
+	intentRepo *IntentRepository
+	remoteRepo repository.RemoteRepository
+	outboxRepo *OutboxRepository
+}
 
 func NewRepositoryFactory() repository.RepositoryFactory {
-	return &repositoryFactory{}
+	outbox := newOutboxRepository()
+	return &repositoryFactory{
+		intentRepo: newIntentRepository(outbox),
+		remoteRepo: newGitRemoteRepository(),
+		outboxRepo: outbox,
+	}
 }
 
 func (f *repositoryFactory) IntentRepository() repository.IntentRepository {
-	return newIntentRepository()
+	return f.intentRepo
 }
 
 func (f *repositoryFactory) RemoteRepository() repository.RemoteRepository {
-	return newGitRemoteRepository()
+	return f.remoteRepo
+}
+
+func (f *repositoryFactory) OutboxRepository() repository.OutboxRepository {
+	return f.outboxRepo
 }
@@ -2,14 +2,17 @@ package inmem_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 	inmem "github.com/noelukwa/git-explorer/internal/explorer/repository/in-mem"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSaveRepo(t *testing.T) {
@@ -22,6 +25,9 @@ func TestSaveRepo(t *testing.T) {
 	savedRepo, err := r.GetRepo(context.Background(), "test/repo")
 	assert.NoError(t, err)
 	assert.Equal(t, repo, *savedRepo)
+
+	_, err = r.GetRepo(context.Background(), "test/missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
 }
 
 func TestSaveManyCommit(t *testing.T) {
@@ -31,7 +37,7 @@ func TestSaveManyCommit(t *testing.T) {
 	r := inmem.NewRepositoryFactory().RemoteRepository()
 	r.SaveRepo(context.Background(), &repo)
 
-	err := r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{commit})
+	_, err := r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{commit})
 	assert.NoError(t, err)
 
 	commits, err := r.FindCommits(context.Background(), repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{Page: 1, PerPage: 10})
@@ -40,11 +46,80 @@ func TestSaveManyCommit(t *testing.T) {
 	assert.Equal(t, commit.Hash, commits.Data[0].Hash)
 }
 
+func TestSaveManyCommit_CountsDuplicates(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+
+	stats, err := r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{{Hash: "1"}, {Hash: "2"}, {Hash: "2"}})
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 2, Duplicates: 1}, stats)
+
+	stats, err = r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{{Hash: "2"}, {Hash: "3"}})
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 1, Duplicates: 1}, stats)
+}
+
+func TestSaveManyCommit_SkipsProcessedEvent(t *testing.T) {
+	ctx := context.Background()
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(ctx, &repo)
+
+	event := repository.ProcessedEvent{ID: uuid.New(), Kind: events.NEW_COMMITS_DATA}
+	stats, err := r.SaveManyCommit(ctx, repo.ID, []models.Commit{{Hash: "1"}}, event)
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 1}, stats)
+
+	// The redelivered event writes nothing, not even its new commits.
+	_, err = r.SaveManyCommit(ctx, repo.ID, []models.Commit{{Hash: "1"}, {Hash: "2"}}, event)
+	assert.ErrorIs(t, err, repository.ErrDuplicateEvent)
+
+	page, err := r.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 1)
+}
+
+func TestFork_SharedCommits(t *testing.T) {
+	ctx := context.Background()
+	upstream := models.Repository{FullName: "test/repo", ID: 1}
+	fork := models.Repository{FullName: "fork/repo", ID: 2}
+	alice := models.Author{ID: 1, Username: "alice"}
+	bob := models.Author{ID: 2, Username: "bob"}
+	shared := []models.Commit{
+		{Hash: "1", Author: alice, CreatedAt: time.Now()},
+		{Hash: "2", Author: alice, CreatedAt: time.Now()},
+	}
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(ctx, &upstream)
+	r.SaveRepo(ctx, &fork)
+
+	_, err := r.SaveManyCommit(ctx, upstream.ID, shared)
+	require.NoError(t, err)
+	stats, err := r.SaveManyCommit(ctx, fork.ID, append(shared, models.Commit{Hash: "3", Author: bob, CreatedAt: time.Now()}))
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 3}, stats)
+
+	page, err := r.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "fork/repo"}, repository.Pagination{PerPage: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 3)
+
+	committers, err := r.GetTopCommitters(ctx, "fork/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, committers, 2)
+	assert.Equal(t, int64(2), committers[0].Commits)
+
+	committers, err = r.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, committers, 1)
+}
+
 func TestGetTopCommitters(t *testing.T) {
 	repo := models.Repository{FullName: "test/repo", ID: 1}
-	commit1 := models.Commit{Hash: "123", Author: models.Author{Username: "author1"}, CreatedAt: time.Now()}
-	commit2 := models.Commit{Hash: "124", Author: models.Author{Username: "author2"}, CreatedAt: time.Now()}
-	commit3 := models.Commit{Hash: "125", Author: models.Author{Username: "author1"}, CreatedAt: time.Now()}
+	commit1 := models.Commit{Hash: "123", Author: models.Author{ID: 1, Username: "author1"}, CreatedAt: time.Now()}
+	commit2 := models.Commit{Hash: "124", Author: models.Author{ID: 2, Username: "author2"}, CreatedAt: time.Now()}
+	commit3 := models.Commit{Hash: "125", Author: models.Author{ID: 1, Username: "author1"}, CreatedAt: time.Now()}
 
 	r := inmem.NewRepositoryFactory().RemoteRepository()
 	r.SaveRepo(context.Background(), &repo)
@@ -59,6 +134,31 @@ func TestGetTopCommitters(t *testing.T) {
 	assert.Equal(t, int64(1), stats[1].Commits)
 }
 
+func TestGetTopCommitters_Ties(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	zed := models.Author{ID: 1, Username: "zed", Email: "zed@example.com"}
+	amyWork := models.Author{ID: 2, Username: "amy", Email: "amy@work.example.com"}
+	amyHome := models.Author{ID: 3, Username: "amy", Email: "amy@home.example.com"}
+	now := time.Now()
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+	r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{
+		{Hash: "1", Author: zed, CreatedAt: now},
+		{Hash: "2", Author: amyWork, CreatedAt: now},
+		{Hash: "3", Author: amyHome, CreatedAt: now},
+	})
+
+	// Equal counts are ordered by username, then email, whatever the IDs.
+	stats, err := r.GetTopCommitters(context.Background(), "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{
+		{Author: amyHome, Commits: 1},
+		{Author: amyWork, Commits: 1},
+		{Author: zed, Commits: 1},
+	}, stats)
+}
+
 func TestFindCommits(t *testing.T) {
 	repo := models.Repository{FullName: "test/repo", ID: 1}
 	commit1 := models.Commit{Hash: "123", Author: models.Author{Username: "author1"}, CreatedAt: time.Now()}
@@ -106,8 +206,7 @@ func TestSaveIntent_EmptyID(t *testing.T) {
 	}
 
 	err := r.SaveIntent(context.Background(), intent)
-	assert.Error(t, err)
-	assert.Equal(t, "intent ID cannot be empty", err.Error())
+	assert.ErrorIs(t, err, repository.ErrInvalid)
 }
 
 func TestGetIntentById(t *testing.T) {
@@ -127,9 +226,8 @@ func TestGetIntentById(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, intent, savedIntent)
 
-	nonExistentIntent, err := r.GetIntentById(context.Background(), uuid.New())
-	assert.NoError(t, err)
-	assert.Nil(t, nonExistentIntent)
+	_, err = r.GetIntentById(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
 }
 
 func TestGetIntentByRepo(t *testing.T) {
@@ -149,9 +247,8 @@ func TestGetIntentByRepo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, intent, savedIntent)
 
-	nonExistentIntent, err := r.GetIntentByRepo(context.Background(), "non/existent/repo")
-	assert.NoError(t, err)
-	assert.Nil(t, nonExistentIntent)
+	_, err = r.GetIntentByRepo(context.Background(), "non/existent/repo")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
 }
 
 func TestGetIntents(t *testing.T) {
@@ -202,30 +299,286 @@ func TestUpdateIntent(t *testing.T) {
 	r.SaveIntent(context.Background(), intent)
 
 	newSince := time.Now().Add(-time.Hour)
+	inactive := false
 	update := &models.IntentUpdate{
 		ID:       intent.ID,
-		IsActive: false,
+		IsActive: &inactive,
 		Since:    &newSince,
 	}
 
-	err := r.UpdateIntent(context.Background(), update)
+	var before, after models.Intent
+	err := r.UpdateIntent(context.Background(), update, func(b, a *models.Intent) ([]repository.OutboxMessage, error) {
+		before, after = *b, *a
+		return nil, nil
+	})
 	assert.NoError(t, err)
+	assert.True(t, before.IsActive)
+	assert.False(t, after.IsActive)
 
 	updatedIntent, err := r.GetIntentById(context.Background(), intent.ID)
 	assert.NoError(t, err)
-	assert.Equal(t, update.IsActive, updatedIntent.IsActive)
+	assert.Equal(t, *update.IsActive, updatedIntent.IsActive)
 	assert.Equal(t, *update.Since, updatedIntent.Since)
+
+	// Fields left out of the update are kept.
+	err = r.UpdateIntent(context.Background(), &models.IntentUpdate{ID: intent.ID}, nil)
+	assert.NoError(t, err)
+
+	updatedIntent, err = r.GetIntentById(context.Background(), intent.ID)
+	assert.NoError(t, err)
+	assert.False(t, updatedIntent.IsActive)
+	assert.Equal(t, newSince, updatedIntent.Since)
 }
 
 func TestUpdateIntent_NonExistent(t *testing.T) {
 	r := inmem.NewRepositoryFactory().IntentRepository()
 
 	update := &models.IntentUpdate{
-		ID:       uuid.New(),
-		IsActive: false,
+		ID: uuid.New(),
 	}
 
-	err := r.UpdateIntent(context.Background(), update)
-	assert.Error(t, err)
-	assert.Equal(t, "intent not found", err.Error())
+	err := r.UpdateIntent(context.Background(), update, nil)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestFindCommits_Filters(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := jan.AddDate(0, 1, 0)
+	mar := jan.AddDate(0, 2, 0)
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+	r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{
+		{Hash: "1", Author: models.Author{Username: "author1"}, CreatedAt: jan},
+		{Hash: "2", Author: models.Author{Username: "author2"}, CreatedAt: feb},
+		{Hash: "3", Author: models.Author{Username: "author1"}, CreatedAt: mar},
+	})
+
+	pagination := repository.Pagination{PerPage: 10, WithTotal: true}
+
+	response, err := r.FindCommits(context.Background(), repository.CommitsFilter{RepositoryName: "test/repo", EndDate: &feb}, pagination)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), response.TotalCount)
+	assert.Equal(t, "2", response.Data[0].Hash, "newest commit comes first")
+
+	response, err = r.FindCommits(context.Background(), repository.CommitsFilter{RepositoryName: "test/repo", Author: "author1"}, pagination)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), response.TotalCount)
+}
+
+func TestFindCommits_Keyset(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+	// Two commits share a timestamp, so the hash has to break the tie.
+	r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{
+		{Hash: "a", CreatedAt: day},
+		{Hash: "b", CreatedAt: day.AddDate(0, 0, 1)},
+		{Hash: "c", CreatedAt: day.AddDate(0, 0, 1)},
+		{Hash: "d", CreatedAt: day.AddDate(0, 0, 2)},
+		{Hash: "e", CreatedAt: day.AddDate(0, 0, 3)},
+	})
+
+	filter := repository.CommitsFilter{RepositoryName: "test/repo"}
+	hashes := func(page repository.PaginatedResponse[models.Commit]) []string {
+		var out []string
+		for _, c := range page.Data {
+			out = append(out, c.Hash)
+		}
+		return out
+	}
+
+	first, err := r.FindCommits(context.Background(), filter, repository.Pagination{PerPage: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e", "d"}, hashes(first))
+	assert.Zero(t, first.TotalCount, "total is only counted when asked for")
+	assert.Empty(t, first.Prev)
+	require.NotEmpty(t, first.Next)
+
+	second, err := r.FindCommits(context.Background(), filter, repository.Pagination{PerPage: 2, Cursor: first.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, hashes(second))
+	require.NotEmpty(t, second.Next)
+	require.NotEmpty(t, second.Prev)
+
+	last, err := r.FindCommits(context.Background(), filter, repository.Pagination{PerPage: 2, Cursor: second.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, hashes(last))
+	assert.Empty(t, last.Next)
+
+	back, err := r.FindCommits(context.Background(), filter, repository.Pagination{PerPage: 2, Cursor: second.Prev})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e", "d"}, hashes(back))
+	assert.Empty(t, back.Prev)
+	assert.Equal(t, first.Next, back.Next)
+
+	_, err = r.FindCommits(context.Background(), filter, repository.Pagination{PerPage: 2, Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, repository.ErrInvalid)
+}
+
+func TestGetTopCommitters_LargeHistory(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	alice := models.Author{ID: 1, Username: "alice"}
+	bob := models.Author{ID: 2, Username: "bob"}
+	carol := models.Author{ID: 3, Username: "carol"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Far more commits than a single page of FindCommits, with bob and carol
+	// tied, and each author committing once an hour.
+	var commits []models.Commit
+	for author, count := range map[models.Author]int{alice: 1500, bob: 1200, carol: 1200} {
+		for i := 0; i < count; i++ {
+			commits = append(commits, models.Commit{
+				Hash:      fmt.Sprintf("%s-%d", author.Username, i),
+				Author:    author,
+				CreatedAt: start.Add(time.Duration(i) * time.Hour),
+			})
+		}
+	}
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+	r.SaveManyCommit(context.Background(), repo.ID, commits)
+
+	stats, err := r.GetTopCommitters(context.Background(), "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{
+		{Author: alice, Commits: 1500},
+		{Author: bob, Commits: 1200},
+		{Author: carol, Commits: 1200},
+	}, stats)
+
+	stats, err = r.GetTopCommitters(context.Background(), "test/repo", nil, nil, repository.Pagination{Page: 2, PerPage: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{{Author: bob, Commits: 1200}}, stats)
+
+	// Only the first 1300 hours: alice has 1300 commits in range, the others
+	// all of theirs.
+	end := start.Add(1299 * time.Hour)
+	stats, err = r.GetTopCommitters(context.Background(), "test/repo", &start, &end, repository.Pagination{Page: 1, PerPage: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1300), stats[0].Commits)
+
+	// A new name does not make a new committer: carol is counted once, with
+	// the details of her latest commits.
+	renamed := carol
+	renamed.Name = "Carol Smith"
+	var renamedCommits []models.Commit
+	for i := 0; i < 400; i++ {
+		renamedCommits = append(renamedCommits, models.Commit{
+			Hash:      fmt.Sprintf("carol-renamed-%d", i),
+			Author:    renamed,
+			CreatedAt: start.Add(time.Duration(1200+i) * time.Hour),
+		})
+	}
+	r.SaveManyCommit(context.Background(), repo.ID, renamedCommits)
+
+	stats, err = r.GetTopCommitters(context.Background(), "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{
+		{Author: renamed, Commits: 1600},
+		{Author: alice, Commits: 1500},
+		{Author: bob, Commits: 1200},
+	}, stats)
+
+	buckets, err := r.GetCommitActivity(context.Background(), repository.ActivityFilter{
+		RepositoryName: "test/repo",
+		Interval:       repository.Month,
+		GroupBy:        []repository.GroupAbleCol{repository.CreatedAt, repository.GroupByAuthor},
+	})
+	assert.NoError(t, err)
+	perAuthor := make(map[models.Author]int64)
+	for _, bucket := range buckets {
+		perAuthor[*bucket.Author] += bucket.Commits
+	}
+	assert.Equal(t, map[models.Author]int64{alice: 1500, bob: 1200, renamed: 1600}, perAuthor)
+}
+
+func TestGetCommitActivity(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	alice := models.Author{ID: 1, Username: "alice"}
+	bob := models.Author{ID: 2, Username: "bob"}
+	day := func(d, h int) time.Time { return time.Date(2024, 1, d, h, 0, 0, 0, time.UTC) }
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+	r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{
+		{Hash: "1", Author: alice, CreatedAt: day(1, 10)},
+		{Hash: "2", Author: bob, CreatedAt: day(1, 23)},
+		{Hash: "3", Author: alice, CreatedAt: day(3, 12)},
+	})
+
+	filter := repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Day}
+	buckets, err := r.GetCommitActivity(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ActivityBucket{
+		{Start: day(1, 0), Commits: 2},
+		{Start: day(2, 0), Commits: 0},
+		{Start: day(3, 0), Commits: 1},
+	}, buckets)
+
+	// Two hours east of UTC bob's late commit lands on the 2nd.
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	filter.Location = loc
+	buckets, err = r.GetCommitActivity(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 3)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, loc), buckets[1].Start)
+	assert.Equal(t, int64(1), buckets[1].Commits)
+
+	filter.Location = nil
+	filter.GroupBy = []repository.GroupAbleCol{repository.CreatedAt, repository.GroupByAuthor}
+	start, end := day(1, 0), day(2, 0)
+	filter.StartDate, filter.EndDate = &start, &end
+	buckets, err = r.GetCommitActivity(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ActivityBucket{
+		{Start: day(1, 0), Author: &alice, Commits: 1},
+		{Start: day(1, 0), Author: &bob, Commits: 1},
+		{Start: day(2, 0), Author: &alice, Commits: 0},
+		{Start: day(2, 0), Author: &bob, Commits: 0},
+	}, buckets)
+
+	// 2024-01-01 is a Monday, so every commit falls in the first week.
+	filter = repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Week}
+	buckets, err = r.GetCommitActivity(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ActivityBucket{{Start: day(1, 0), Commits: 3}}, buckets)
+}
+
+func TestSearchCommits(t *testing.T) {
+	repo := models.Repository{FullName: "test/repo", ID: 1}
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := inmem.NewRepositoryFactory().RemoteRepository()
+	r.SaveRepo(context.Background(), &repo)
+	r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{
+		{Hash: "1", Message: "Fix JIRA-42 crash", Author: models.Author{Username: "author1"}, CreatedAt: jan},
+		{Hash: "2", Message: "Refactor parser", Author: models.Author{Username: "author2"}, CreatedAt: jan.Add(time.Hour)},
+		{Hash: "3", Message: "Follow up on jira-42", Author: models.Author{Username: "author2"}, CreatedAt: jan.Add(2 * time.Hour)},
+	})
+
+	pagination := repository.Pagination{Page: 1, PerPage: 10}
+	response, err := r.SearchCommits(context.Background(), "JIRA-42", repository.CommitsFilter{RepositoryName: "test/repo"}, pagination)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), response.TotalCount)
+	assert.Equal(t, "3", response.Data[0].Hash)
+	assert.Equal(t, "Follow up on <mark>jira-42</mark>", response.Data[0].Highlight)
+
+	response, err = r.SearchCommits(context.Background(), "jira-42", repository.CommitsFilter{RepositoryName: "test/repo", Author: "author1"}, pagination)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.TotalCount)
+	assert.Equal(t, "1", response.Data[0].Hash)
+
+	// Markup in the message is escaped, only the highlight is a tag.
+	r.SaveManyCommit(context.Background(), repo.ID, []models.Commit{
+		{Hash: "4", Message: `Escape <script>alert("x")</script> & more`, CreatedAt: jan.Add(3 * time.Hour)},
+	})
+	response, err = r.SearchCommits(context.Background(), "alert", repository.CommitsFilter{RepositoryName: "test/repo"}, pagination)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.TotalCount)
+	assert.Equal(t, "Escape &lt;script&gt;<mark>alert</mark>(&#34;x&#34;)&lt;/script&gt; &amp; more", response.Data[0].Highlight)
 }
@@ -2,7 +2,7 @@ package inmem
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/google/uuid"
@@ -12,6 +12,7 @@ import (
 
 type IntentRepository struct {
 	intents map[string]*models.Intent
+	outbox  *OutboxRepository
 	mu      sync.RWMutex
 }
 
@@ -25,7 +26,7 @@ func (r *IntentRepository) GetIntentById(ctx context.Context, id uuid.UUID) (*mo
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("intent %s: %w", id, repository.ErrNotFound)
 }
 
 func (r *IntentRepository) GetIntentByRepo(ctx context.Context, repo string) (*models.Intent, error) {
@@ -37,7 +38,7 @@ func (r *IntentRepository) GetIntentByRepo(ctx context.Context, repo string) (*m
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("intent for %s: %w", repo, repository.ErrNotFound)
 }
 
 func (r *IntentRepository) GetIntents(ctx context.Context, filter repository.IntentFilter) ([]*models.Intent, error) {
@@ -55,37 +56,47 @@ func (r *IntentRepository) GetIntents(ctx context.Context, filter repository.Int
 	return result, nil
 }
 
-func newIntentRepository() *IntentRepository {
+func newIntentRepository(outbox *OutboxRepository) *IntentRepository {
 	return &IntentRepository{
 		intents: make(map[string]*models.Intent),
+		outbox:  outbox,
 	}
 }
 
-func (r *IntentRepository) SaveIntent(ctx context.Context, intent *models.Intent) error {
+func (r *IntentRepository) SaveIntent(ctx context.Context, intent *models.Intent, outbox ...repository.OutboxMessage) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if intent.ID == uuid.Nil {
-		return errors.New("intent ID cannot be empty")
+		return fmt.Errorf("%w: intent ID cannot be empty", repository.ErrInvalid)
 	}
 
 	r.intents[intent.ID.String()] = intent
+	r.outbox.append(outbox)
 	return nil
 }
 
-func (r *IntentRepository) UpdateIntent(ctx context.Context, update *models.IntentUpdate) error {
+func (r *IntentRepository) UpdateIntent(ctx context.Context, update *models.IntentUpdate, outbox repository.OutboxFunc) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	intent, exists := r.intents[update.ID.String()]
 	if !exists {
-		return errors.New("intent not found")
+		return fmt.Errorf("intent %s: %w", update.ID, repository.ErrNotFound)
 	}
 
-	intent.IsActive = update.IsActive
-	if update.Since != nil {
-		intent.Since = *update.Since
+	before := *intent
+	after := before
+	update.Apply(&after)
+
+	if outbox != nil {
+		messages, err := outbox(&before, &after)
+		if err != nil {
+			return err
+		}
+		r.outbox.append(messages)
 	}
+	*intent = after
 
 	return nil
 }
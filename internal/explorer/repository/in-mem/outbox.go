@@ -0,0 +1,87 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+)
+
+type OutboxRepository struct {
+	pending []repository.OutboxMessage
+	mu      sync.Mutex
+	// claim is held by ClaimPending for the whole call, so only one caller
+	// works through the pending messages at a time.
+	claim sync.Mutex
+}
+
+func newOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{}
+}
+
+func (r *OutboxRepository) GetPendingMessages(ctx context.Context, limit int) ([]repository.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if limit > len(r.pending) {
+		limit = len(r.pending)
+	}
+
+	result := make([]repository.OutboxMessage, limit)
+	copy(result, r.pending[:limit])
+	return result, nil
+}
+
+// ClaimPending drops abandoned messages, which the handler is expected to
+// have logged; nothing is kept across restarts anyway.
+func (r *OutboxRepository) ClaimPending(ctx context.Context, limit int, handle repository.OutboxHandler) (int, error) {
+	r.claim.Lock()
+	defer r.claim.Unlock()
+
+	messages, err := r.GetPendingMessages(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		result, _ := handle(msg)
+
+		r.mu.Lock()
+		switch result {
+		case repository.OutboxPublished, repository.OutboxAbandoned:
+			r.remove(msg.ID)
+		case repository.OutboxRetry:
+			for i := range r.pending {
+				if r.pending[i].ID == msg.ID {
+					r.pending[i].Attempts++
+				}
+			}
+		}
+		r.mu.Unlock()
+
+		if result == repository.OutboxRetry {
+			break
+		}
+	}
+
+	return len(messages), nil
+}
+
+func (r *OutboxRepository) remove(id uuid.UUID) {
+	for i, msg := range r.pending {
+		if msg.ID == id {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// append is called while the owning repository still holds its lock, so the
+// messages become visible together with the change that produced them.
+func (r *OutboxRepository) append(messages []repository.OutboxMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, messages...)
+}
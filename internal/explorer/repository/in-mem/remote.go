@@ -3,26 +3,35 @@ package inmem
 import (
 	"context"
 	"fmt"
+	"html"
+	"regexp"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 )
 
 type RemoteRepository struct {
-	repos   map[string]*models.Repository
-	commits map[int64][]models.Commit
-	mu      sync.RWMutex
+	repos     map[string]*models.Repository
+	commits   map[int64][]models.Commit
+	processed map[uuid.UUID]time.Time
+	mu        sync.RWMutex
 }
 
-// SaveAuthor implements repository.RemoteRepository.
+// SaveAuthor implements repository.RemoteRepository. Authors are kept with
+// their commits, so there is nothing to store on its own.
 func (r *RemoteRepository) SaveAuthor(ctx context.Context, author models.Author) error {
-	panic("unimplemented")
+	if author.ID == 0 && author.Username == "" {
+		return fmt.Errorf("%w: author has no ID or username", repository.ErrInvalid)
+	}
+	return nil
 }
 
-func (r *RemoteRepository) SaveManyCommit(ctx context.Context, repoID int64, commits []models.Commit) error {
+func (r *RemoteRepository) SaveManyCommit(ctx context.Context, repoID int64, commits []models.Commit, processed ...repository.ProcessedEvent) (repository.IngestStats, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -34,12 +43,51 @@ func (r *RemoteRepository) SaveManyCommit(ctx context.Context, repoID int64, com
 		}
 	}
 	if !found {
-		return fmt.Errorf("repository with ID %d not found", repoID)
+		return repository.IngestStats{}, fmt.Errorf("repository with ID %d: %w", repoID, repository.ErrNotFound)
+	}
+
+	for _, event := range processed {
+		if _, ok := r.processed[event.ID]; ok {
+			return repository.IngestStats{}, fmt.Errorf("%w: %s", repository.ErrDuplicateEvent, event.ID)
+		}
+	}
+	now := time.Now()
+	for _, event := range processed {
+		r.processed[event.ID] = now
 	}
 
-	r.commits[repoID] = append(r.commits[repoID], commits...)
+	seen := make(map[string]bool, len(r.commits[repoID]))
+	for _, commit := range r.commits[repoID] {
+		seen[commit.Hash] = true
+	}
 
-	return nil
+	var stats repository.IngestStats
+	for _, commit := range commits {
+		if seen[commit.Hash] {
+			stats.Duplicates++
+			continue
+		}
+		seen[commit.Hash] = true
+		commit.Merge = len(commit.Parents) > 1
+		r.commits[repoID] = append(r.commits[repoID], commit)
+		stats.Inserted++
+	}
+
+	return stats, nil
+}
+
+func (r *RemoteRepository) PruneProcessedEvents(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, processedAt := range r.processed {
+		if processedAt.Before(before) {
+			delete(r.processed, id)
+			n++
+		}
+	}
+	return n, nil
 }
 
 func (r *RemoteRepository) GetTopCommitters(ctx context.Context, repository string, startDate *time.Time, endDate *time.Time, pagination repository.Pagination) ([]models.AuthorStats, error) {
@@ -56,23 +104,36 @@ func (r *RemoteRepository) GetTopCommitters(ctx context.Context, repository stri
 		return nil, nil
 	}
 
-	committerStats := make(map[string]int64)
+	committerStats := make(map[authorKey]int64)
+	latest := make(map[authorKey]models.Author)
 	for _, commit := range repoCommits {
+		key := keyOf(commit.Author)
+		latest[key] = commit.Author
 		if (startDate == nil || !commit.CreatedAt.Before(*startDate)) &&
 			(endDate == nil || !commit.CreatedAt.After(*endDate)) {
-			committerStats[commit.Author.Username]++
+			committerStats[key]++
 		}
 	}
 
 	var authorStats []models.AuthorStats
-	for username, count := range committerStats {
+	for key, count := range committerStats {
 		authorStats = append(authorStats, models.AuthorStats{
-			Author:  models.Author{Username: username},
+			Author:  latest[key],
 			Commits: count,
 		})
 	}
 	sort.Slice(authorStats, func(i, j int) bool {
-		return authorStats[i].Commits > authorStats[j].Commits
+		a, b := authorStats[i], authorStats[j]
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		if a.Author.Username != b.Author.Username {
+			return a.Author.Username < b.Author.Username
+		}
+		if a.Author.Email != b.Author.Email {
+			return a.Author.Email < b.Author.Email
+		}
+		return a.Author.ID < b.Author.ID
 	})
 
 	start := (pagination.Page - 1) * pagination.PerPage
@@ -90,8 +151,9 @@ func (r *RemoteRepository) GetTopCommitters(ctx context.Context, repository stri
 
 func newGitRemoteRepository() repository.RemoteRepository {
 	return &RemoteRepository{
-		repos:   make(map[string]*models.Repository),
-		commits: make(map[int64][]models.Commit),
+		repos:     make(map[string]*models.Repository),
+		commits:   make(map[int64][]models.Commit),
+		processed: make(map[uuid.UUID]time.Time),
 	}
 }
 
@@ -109,13 +171,18 @@ func (r *RemoteRepository) GetRepo(ctx context.Context, id string) (*models.Repo
 
 	repo, exists := r.repos[id]
 	if !exists {
-		return nil, nil
+		return nil, fmt.Errorf("repository %s: %w", id, repository.ErrNotFound)
 	}
 
 	return repo, nil
 }
 
 func (r *RemoteRepository) FindCommits(ctx context.Context, filter repository.CommitsFilter, pagination repository.Pagination) (repository.PaginatedResponse[models.Commit], error) {
+	cursor, err := repository.DecodeCursor(pagination.Cursor)
+	if err != nil {
+		return repository.PaginatedResponse[models.Commit]{}, err
+	}
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -131,25 +198,286 @@ func (r *RemoteRepository) FindCommits(ctx context.Context, filter repository.Co
 	var filteredCommits []models.Commit
 	for _, commit := range repoCommits {
 		if (filter.StartDate == nil || !commit.CreatedAt.Before(*filter.StartDate)) &&
-			(filter.EndDate == nil || !commit.CreatedAt.Before(*filter.EndDate)) {
+			(filter.EndDate == nil || !commit.CreatedAt.After(*filter.EndDate)) &&
+			(filter.Author == "" || commit.Author.Username == filter.Author) {
 			filteredCommits = append(filteredCommits, commit)
 		}
 	}
+	sort.Slice(filteredCommits, func(i, j int) bool {
+		return newer(filteredCommits[i], filteredCommits[j].CreatedAt, filteredCommits[j].Hash)
+	})
+
+	// Walk away from the cursor, newest first for forward pages and oldest
+	// first for backward ones, keeping one row more than the page size.
+	var rows []models.Commit
+	if cursor != nil && cursor.Backward {
+		for i := len(filteredCommits) - 1; i >= 0 && len(rows) <= pagination.PerPage; i-- {
+			if newer(filteredCommits[i], cursor.CreatedAt, cursor.Hash) {
+				rows = append(rows, filteredCommits[i])
+			}
+		}
+	} else {
+		for _, commit := range filteredCommits {
+			if len(rows) > pagination.PerPage {
+				break
+			}
+			if cursor == nil || older(commit, cursor.CreatedAt, cursor.Hash) {
+				rows = append(rows, commit)
+			}
+		}
+	}
+
+	page := repository.KeysetPage(rows, pagination.PerPage, cursor, func(c models.Commit) (time.Time, string) {
+		return c.CreatedAt, c.Hash
+	})
+	if pagination.WithTotal {
+		page.TotalCount = int64(len(filteredCommits))
+	}
+	return page, nil
+}
+
+// newer reports whether c sorts after (createdAt, hash).
+func newer(c models.Commit, createdAt time.Time, hash string) bool {
+	if c.CreatedAt.Equal(createdAt) {
+		return c.Hash > hash
+	}
+	return c.CreatedAt.After(createdAt)
+}
+
+// older reports whether c sorts before (createdAt, hash).
+func older(c models.Commit, createdAt time.Time, hash string) bool {
+	if c.CreatedAt.Equal(createdAt) {
+		return c.Hash < hash
+	}
+	return c.CreatedAt.Before(createdAt)
+}
+
+// authorKey identifies an author like the postgres store does: by GitHub ID,
+// or by email for an author without a GitHub account. An author is reported
+// with the details of its last stored commit.
+type authorKey struct {
+	id    int64
+	email string
+}
+
+func keyOf(author models.Author) authorKey {
+	if author.ID != 0 {
+		return authorKey{id: author.ID}
+	}
+	return authorKey{email: author.Email}
+}
+
+type activityKey struct {
+	start  int64
+	author authorKey
+}
+
+func (r *RemoteRepository) GetFirstCommitDate(ctx context.Context, repository string) (*time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	repo, exists := r.repos[repository]
+	if !exists {
+		return nil, nil
+	}
+
+	var first *time.Time
+	for _, commit := range r.commits[repo.ID] {
+		if first == nil || commit.CreatedAt.Before(*first) {
+			createdAt := commit.CreatedAt
+			first = &createdAt
+		}
+	}
+	return first, nil
+}
+
+func (r *RemoteRepository) GetCommitActivity(ctx context.Context, filter repository.ActivityFilter) ([]models.ActivityBucket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	repo, exists := r.repos[filter.RepositoryName]
+	if !exists {
+		return nil, nil
+	}
+
+	loc := filter.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	byAuthor := filter.ByAuthor()
+
+	counts := make(map[activityKey]int64)
+	latest := make(map[authorKey]models.Author)
+	seen := make(map[authorKey]bool)
+	var first, last time.Time
+	for _, commit := range r.commits[repo.ID] {
+		latest[keyOf(commit.Author)] = commit.Author
+		if (filter.StartDate != nil && commit.CreatedAt.Before(*filter.StartDate)) ||
+			(filter.EndDate != nil && commit.CreatedAt.After(*filter.EndDate)) {
+			continue
+		}
+
+		key := activityKey{start: truncate(commit.CreatedAt, filter.Interval, loc).Unix()}
+		if byAuthor {
+			key.author = keyOf(commit.Author)
+			seen[key.author] = true
+		}
+		counts[key]++
+
+		if first.IsZero() || commit.CreatedAt.Before(first) {
+			first = commit.CreatedAt
+		}
+		if commit.CreatedAt.After(last) {
+			last = commit.CreatedAt
+		}
+	}
+
+	if filter.StartDate != nil {
+		first = *filter.StartDate
+	}
+	if filter.EndDate != nil {
+		last = *filter.EndDate
+	}
+	if first.IsZero() || last.IsZero() {
+		return nil, nil
+	}
+
+	// Without a split there is a single series, keyed on the zero author.
+	authors := []models.Author{{}}
+	if byAuthor {
+		authors = authors[:0]
+		for key := range seen {
+			authors = append(authors, latest[key])
+		}
+		sort.Slice(authors, func(i, j int) bool {
+			if authors[i].Username != authors[j].Username {
+				return authors[i].Username < authors[j].Username
+			}
+			if authors[i].Email != authors[j].Email {
+				return authors[i].Email < authors[j].Email
+			}
+			return authors[i].ID < authors[j].ID
+		})
+	}
+
+	var buckets []models.ActivityBucket
+	end := truncate(last, filter.Interval, loc)
+	for start := truncate(first, filter.Interval, loc); !start.After(end); start = next(start, filter.Interval, loc) {
+		for _, author := range authors {
+			bucket := models.ActivityBucket{
+				Start:   start,
+				Commits: counts[activityKey{start: start.Unix(), author: keyOf(author)}],
+			}
+			if byAuthor {
+				author := author
+				bucket.Author = &author
+			}
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	return buckets, nil
+}
+
+// truncate returns the start of the bucket holding t, with weeks starting on
+// Monday like postgres' date_trunc.
+func truncate(t time.Time, interval repository.Interval, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch interval {
+	case repository.Hour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case repository.Week:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case repository.Month:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+}
+
+// next returns the start of the bucket after the one starting at t.
+func next(t time.Time, interval repository.Interval, loc *time.Location) time.Time {
+	year, month, day := t.Date()
+	switch interval {
+	case repository.Hour:
+		return time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+	case repository.Week:
+		return time.Date(year, month, day+7, 0, 0, 0, 0, loc)
+	case repository.Month:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+	}
+}
+
+// SearchCommits matches query as a case-insensitive substring of the message.
+// Every match ranks the same, so the newest come first.
+func (r *RemoteRepository) SearchCommits(ctx context.Context, query string, filter repository.CommitsFilter, pagination repository.Pagination) (repository.PaginatedResponse[models.CommitMatch], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	repo, exists := r.repos[filter.RepositoryName]
+	if !exists {
+		return repository.PaginatedResponse[models.CommitMatch]{}, nil
+	}
+
+	if query == "" {
+		return repository.PaginatedResponse[models.CommitMatch]{}, nil
+	}
+	pattern := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+
+	var matches []models.CommitMatch
+	for _, commit := range r.commits[repo.ID] {
+		if (filter.StartDate != nil && commit.CreatedAt.Before(*filter.StartDate)) ||
+			(filter.EndDate != nil && commit.CreatedAt.After(*filter.EndDate)) ||
+			(filter.Author != "" && commit.Author.Username != filter.Author) {
+			continue
+		}
+
+		if !pattern.MatchString(commit.Message) {
+			continue
+		}
+		matches = append(matches, models.CommitMatch{
+			Commit:    commit,
+			Rank:      1,
+			Highlight: highlight(pattern, commit.Message),
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
 
 	start := (pagination.Page - 1) * pagination.PerPage
 	end := start + pagination.PerPage
-	if end > len(filteredCommits) {
-		end = len(filteredCommits)
+	if end > len(matches) {
+		end = len(matches)
 	}
 
-	if start >= len(filteredCommits) {
-		return repository.PaginatedResponse[models.Commit]{}, nil
+	if start >= len(matches) {
+		return repository.PaginatedResponse[models.CommitMatch]{}, nil
 	}
 
-	return repository.PaginatedResponse[models.Commit]{
-		Data:       filteredCommits[start:end],
-		TotalCount: int64(len(filteredCommits)),
+	return repository.PaginatedResponse[models.CommitMatch]{
+		Data:       matches[start:end],
+		TotalCount: int64(len(matches)),
 		Page:       pagination.Page,
 		PerPage:    pagination.PerPage,
 	}, nil
 }
+
+// highlight wraps the matches of pattern in <mark> tags. The rest of the
+// message is HTML-escaped, as postgres does, so the tags are the only markup.
+func highlight(pattern *regexp.Regexp, message string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(message, -1) {
+		b.WriteString(html.EscapeString(message[last:match[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(message[match[0]:match[1]]))
+		b.WriteString("</mark>")
+		last = match[1]
+	}
+	b.WriteString(html.EscapeString(message[last:]))
+	return b.String()
+}
@@ -5,10 +5,10 @@ import (
 	"embed"
 	"fmt"
 	"log"
+	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 	"github.com/pressly/goose/v3"
 )
@@ -16,9 +16,61 @@ import (
 //go:embed migrations/*.sql
 var migrations embed.FS
 
+// PoolConfig sizes the connection pool. Zero values keep the pgxpool
+// defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
+}
+
+// NewPool connects a pool to the database at url and checks that it is
+// reachable.
+func NewPool(ctx context.Context, url string, cfg PoolConfig) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	if cfg.MaxConns > 0 {
+		config.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		config.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+	if cfg.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to reach database: %w", err)
+	}
+
+	return pool, nil
+}
+
 type pgStore struct {
 	intentsRepo repository.IntentRepository
 	remoteRepo  repository.RemoteRepository
+	outboxRepo  repository.OutboxRepository
 }
 
 func (p *pgStore) RemoteRepository() repository.RemoteRepository {
@@ -29,21 +81,28 @@ func (p *pgStore) IntentRepository() repository.IntentRepository {
 	return p.intentsRepo
 }
 
-func NewStore(conn *pgx.Conn) (repository.RepositoryFactory, error) {
+func (p *pgStore) OutboxRepository() repository.OutboxRepository {
+	return p.outboxRepo
+}
+
+// NewStore runs the migrations and returns repositories backed by pool. The
+// pool stays owned by the caller.
+func NewStore(pool *pgxpool.Pool) (repository.RepositoryFactory, error) {
 	store := &pgStore{
-		intentsRepo: newIntentRepository(conn),
-		remoteRepo:  newRemoteRepository(conn),
+		intentsRepo: newIntentRepository(pool),
+		remoteRepo:  newRemoteRepository(pool),
+		outboxRepo:  newOutboxRepository(pool),
 	}
 
 	log.Println("running database migrations...")
-	if err := store.runMigrate(conn); err != nil {
+	if err := store.runMigrate(pool); err != nil {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
 	return store, nil
 }
 
-func (p *pgStore) runMigrate(conn *pgx.Conn) error {
+func (p *pgStore) runMigrate(pool *pgxpool.Pool) error {
 	goose.SetBaseFS(migrations)
 
 	if err := goose.SetDialect("postgres"); err != nil {
@@ -51,26 +110,12 @@ func (p *pgStore) runMigrate(conn *pgx.Conn) error {
 		return err
 	}
 
-	config, err := pgxpool.ParseConfig(conn.Config().ConnString())
-	if err != nil {
-		return fmt.Errorf("failed to parse connection string: %w", err)
-	}
-
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
-	if err != nil {
-		return fmt.Errorf("failed to create connection pool: %w", err)
-	}
-	defer pool.Close()
-
-	db := pool.Config().ConnConfig.ConnString()
-
-	dbConn, err := goose.OpenDBWithDriver("pgx", db)
-	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
-	}
-	defer dbConn.Close()
+	// The database/sql handle borrows connections from pool, closing it
+	// leaves the pool open.
+	db := stdlib.OpenDBFromPool(pool)
+	defer db.Close()
 
-	if err := goose.Up(dbConn, "migrations"); err != nil {
+	if err := goose.Up(db, "migrations"); err != nil {
 		log.Printf("failed to run goose migrations: %v", err)
 		return err
 	}
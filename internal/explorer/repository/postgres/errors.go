@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+)
+
+// entities names the records of each table in errors shown to clients.
+var entities = map[string]string{
+	"repositories":     "repository",
+	"intents":          "intent",
+	"authors":          "author",
+	"commits":          "commit",
+	"outbox":           "event",
+	"processed_events": "event",
+}
+
+// mapError translates constraint violations and bad input reported by
+// postgres into the repository errors. Their messages end up in API
+// responses, so they only name the kind of record; the postgres error, with
+// its constraint and column names, is logged instead. Anything else is
+// returned untouched.
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	entity, ok := entities[pgErr.TableName]
+	if !ok {
+		entity = "record"
+	}
+
+	switch {
+	case pgErr.Code == "23505":
+		log.Printf("postgres: %v", err)
+		return fmt.Errorf("%w: %s already exists", repository.ErrConflict, entity)
+	case pgErr.Code == "23502", pgErr.Code == "23503", pgErr.Code == "23514":
+		log.Printf("postgres: %v", err)
+		return fmt.Errorf("%w %s", repository.ErrInvalid, entity)
+	case pgErr.Code[:2] == "22":
+		log.Printf("postgres: %v", err)
+		return fmt.Errorf("%w value", repository.ErrInvalid)
+	}
+	return err
+}
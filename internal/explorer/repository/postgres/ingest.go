@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/noelukwa/git-explorer/internal/explorer/models"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository/postgres/sqlc"
+)
+
+// The staging table only lives for the ingest transaction, so it is not part
+// of the schema sqlc knows about.
+const createCommitStaging = `
+CREATE TEMP TABLE commit_staging (
+    hash TEXT NOT NULL,
+    author_id BIGINT NOT NULL,
+    message TEXT NOT NULL,
+    url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    repository_id BIGINT NOT NULL,
+    authored_at TIMESTAMP WITH TIME ZONE,
+    committer_id BIGINT,
+    parents TEXT[] NOT NULL,
+    verified BOOLEAN,
+    verification_reason TEXT,
+    additions INT,
+    deletions INT,
+    changed_files INT
+) ON COMMIT DROP`
+
+const insertStagedCommits = `
+INSERT INTO commits (
+    hash, author_id, message, url, created_at, repository_id, authored_at, committer_id,
+    parents, verified, verification_reason, additions, deletions, changed_files
+)
+SELECT DISTINCT ON (repository_id, hash)
+    hash, author_id, message, url, created_at, repository_id, authored_at, committer_id,
+    parents, verified, verification_reason, additions, deletions, changed_files
+FROM commit_staging
+ORDER BY repository_id, hash
+ON CONFLICT (repository_id, hash) DO NOTHING`
+
+var commitStagingColumns = []string{
+	"hash", "author_id", "message", "url", "created_at", "repository_id", "authored_at", "committer_id",
+	"parents", "verified", "verification_reason", "additions", "deletions", "changed_files",
+}
+
+// SaveManyCommit upserts the authors and committers of commits, copies the
+// commits into a staging table and moves the ones not stored yet into
+// commits, all in one transaction with the processed events.
+func (r *RemoteRepositoryImpl) SaveManyCommit(ctx context.Context, repoID int64, commits []models.Commit, processed ...repository.ProcessedEvent) (repository.IngestStats, error) {
+	if len(commits) == 0 && len(processed) == 0 {
+		return repository.IngestStats{}, nil
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return repository.IngestStats{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.queries.WithTx(tx)
+
+	if err := saveProcessedEvents(ctx, qtx, processed); err != nil {
+		return repository.IngestStats{}, err
+	}
+
+	var people []models.Author
+	for _, commit := range commits {
+		people = append(people, commit.Author)
+		if commit.Committer != (models.Author{}) {
+			people = append(people, commit.Committer)
+		}
+	}
+	authorIDs, err := saveAuthors(ctx, qtx, people)
+	if err != nil {
+		return repository.IngestStats{}, err
+	}
+
+	if _, err := tx.Exec(ctx, createCommitStaging); err != nil {
+		return repository.IngestStats{}, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	rows := make([][]any, 0, len(commits))
+	for _, commit := range commits {
+		var url pgtype.Text
+		if commit.Url != nil {
+			url = pgtype.Text{String: commit.Url.String(), Valid: true}
+		}
+
+		var committerID pgtype.Int8
+		if commit.Committer != (models.Author{}) {
+			committerID = pgtype.Int8{Int64: authorIDs[keyOf(commit.Committer)], Valid: true}
+		}
+
+		var verified pgtype.Bool
+		var reason pgtype.Text
+		if v := commit.Verification; v != nil {
+			verified = pgtype.Bool{Bool: v.Verified, Valid: true}
+			reason = pgtype.Text{String: v.Reason, Valid: true}
+		}
+
+		var additions, deletions, changedFiles pgtype.Int4
+		if st := commit.Stats; st != nil {
+			additions = pgtype.Int4{Int32: int32(st.Additions), Valid: true}
+			deletions = pgtype.Int4{Int32: int32(st.Deletions), Valid: true}
+			changedFiles = pgtype.Int4{Int32: int32(st.ChangedFiles), Valid: true}
+		}
+
+		parents := commit.Parents
+		if parents == nil {
+			parents = []string{}
+		}
+
+		rows = append(rows, []any{
+			commit.Hash,
+			authorIDs[keyOf(commit.Author)],
+			commit.Message,
+			url,
+			pgtype.Timestamptz{Time: commit.CreatedAt, Valid: true},
+			repoID,
+			pgtype.Timestamptz{Time: commit.AuthoredAt, Valid: !commit.AuthoredAt.IsZero()},
+			committerID,
+			parents,
+			verified,
+			reason,
+			additions,
+			deletions,
+			changedFiles,
+		})
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"commit_staging"}, commitStagingColumns, pgx.CopyFromRows(rows)); err != nil {
+		return repository.IngestStats{}, fmt.Errorf("failed to copy commits: %w", mapError(err))
+	}
+
+	tag, err := tx.Exec(ctx, insertStagedCommits)
+	if err != nil {
+		return repository.IngestStats{}, fmt.Errorf("failed to save commits: %w", mapError(err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return repository.IngestStats{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	inserted := int(tag.RowsAffected())
+	return repository.IngestStats{
+		Inserted:   inserted,
+		Duplicates: len(commits) - inserted,
+	}, nil
+}
+
+// authorKey identifies an author by GitHub ID, or by email for an author
+// without a GitHub account.
+type authorKey struct {
+	githubID int64
+	email    string
+}
+
+func keyOf(author models.Author) authorKey {
+	if author.ID != 0 {
+		return authorKey{githubID: author.ID}
+	}
+	return authorKey{email: author.Email}
+}
+
+// saveAuthors upserts the distinct people with the caller's queries and maps
+// each of them to the key of its row. A person seen twice keeps its last
+// details, since a row can only be upserted once per statement.
+func saveAuthors(ctx context.Context, q *sqlc.Queries, people []models.Author) (map[authorKey]int64, error) {
+	index := make(map[authorKey]int)
+	var distinct []models.Author
+	for _, person := range people {
+		key := keyOf(person)
+		if i, ok := index[key]; ok {
+			distinct[i] = person
+			continue
+		}
+		index[key] = len(distinct)
+		distinct = append(distinct, person)
+	}
+
+	var linked sqlc.UpsertLinkedAuthorsParams
+	var unlinked sqlc.UpsertUnlinkedAuthorsParams
+	for _, person := range distinct {
+		if person.ID != 0 {
+			linked.Column1 = append(linked.Column1, person.ID)
+			linked.Column2 = append(linked.Column2, person.Name)
+			linked.Column3 = append(linked.Column3, person.Email)
+			linked.Column4 = append(linked.Column4, person.Username)
+			continue
+		}
+		unlinked.Column1 = append(unlinked.Column1, person.Name)
+		unlinked.Column2 = append(unlinked.Column2, person.Email)
+		unlinked.Column3 = append(unlinked.Column3, person.Username)
+	}
+
+	ids := make(map[authorKey]int64, len(distinct))
+	if len(linked.Column1) > 0 {
+		rows, err := q.UpsertLinkedAuthors(ctx, linked)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save authors: %w", mapError(err))
+		}
+		for _, row := range rows {
+			ids[authorKey{githubID: row.GithubID.Int64}] = row.ID
+		}
+	}
+	if len(unlinked.Column1) > 0 {
+		rows, err := q.UpsertUnlinkedAuthors(ctx, unlinked)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save authors: %w", mapError(err))
+		}
+		for _, row := range rows {
+			ids[authorKey{email: row.Email}] = row.ID
+		}
+	}
+	return ids, nil
+}
+
+func (r *RemoteRepositoryImpl) PruneProcessedEvents(ctx context.Context, before time.Time) (int64, error) {
+	n, err := r.queries.PruneProcessedEvents(ctx, pgtype.Timestamptz{Time: before, Valid: true})
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return n, nil
+}
+
+// saveProcessedEvents records events with the caller's queries, failing with
+// ErrDuplicateEvent on the first one already recorded.
+func saveProcessedEvents(ctx context.Context, q *sqlc.Queries, events []repository.ProcessedEvent) error {
+	for _, event := range events {
+		n, err := q.SaveProcessedEvent(ctx, sqlc.SaveProcessedEventParams{
+			ID:        event.ID,
+			EventKind: string(event.Kind),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save processed event %s: %w", event.ID, mapError(err))
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %s", repository.ErrDuplicateEvent, event.ID)
+		}
+	}
+	return nil
+}
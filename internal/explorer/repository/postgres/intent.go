@@ -3,11 +3,13 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository/postgres/sqlc"
@@ -15,6 +17,7 @@ import (
 
 type IntentRepositoryImpl struct {
 	queries *sqlc.Queries
+	pool    *pgxpool.Pool
 }
 
 // GetIntentById implements repository.IntentRepository.
@@ -22,25 +25,11 @@ func (r *IntentRepositoryImpl) GetIntentById(ctx context.Context, id uuid.UUID)
 	intent, err := r.queries.GetIntentById(ctx, id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
+			return nil, fmt.Errorf("intent %s: %w", id, repository.ErrNotFound)
 		}
 		return nil, err
 	}
-	var since, createdAt time.Time
-	if intent.Since.Valid {
-		since = intent.Since.Time
-	}
-	if intent.CreatedAt.Valid {
-		createdAt = intent.CreatedAt.Time
-	}
-
-	return &models.Intent{
-		ID:         intent.ID,
-		Repository: intent.Repository,
-		Since:      since,
-		CreatedAt:  createdAt,
-		IsActive:   intent.IsActive,
-	}, nil
+	return toIntent(intent), nil
 }
 
 // GetIntentByRepo implements repository.IntentRepository.
@@ -48,25 +37,11 @@ func (r *IntentRepositoryImpl) GetIntentByRepo(ctx context.Context, repo string)
 	intent, err := r.queries.GetIntentByRepoName(ctx, repo)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
+			return nil, fmt.Errorf("intent for %s: %w", repo, repository.ErrNotFound)
 		}
 		return nil, err
 	}
-	var since, createdAt time.Time
-	if intent.Since.Valid {
-		since = intent.Since.Time
-	}
-	if intent.CreatedAt.Valid {
-		createdAt = intent.CreatedAt.Time
-	}
-
-	return &models.Intent{
-		ID:         intent.ID,
-		Repository: intent.Repository,
-		Since:      since,
-		CreatedAt:  createdAt,
-		IsActive:   intent.IsActive,
-	}, nil
+	return toIntent(intent), nil
 }
 
 func (r *IntentRepositoryImpl) GetIntents(ctx context.Context, filter repository.IntentFilter) ([]*models.Intent, error) {
@@ -92,10 +67,10 @@ func (r *IntentRepositoryImpl) GetIntents(ctx context.Context, filter repository
 	return result, nil
 }
 
-func newIntentRepository(conn *pgx.Conn) repository.IntentRepository {
-	return &IntentRepositoryImpl{queries: sqlc.New(conn)}
+func newIntentRepository(pool *pgxpool.Pool) repository.IntentRepository {
+	return &IntentRepositoryImpl{queries: sqlc.New(pool), pool: pool}
 }
-func (r *IntentRepositoryImpl) SaveIntent(ctx context.Context, intent *models.Intent) error {
+func (r *IntentRepositoryImpl) SaveIntent(ctx context.Context, intent *models.Intent, outbox ...repository.OutboxMessage) error {
 	var since, createdAt pgtype.Timestamptz
 	if !intent.Since.IsZero() {
 		since.Time = intent.Since
@@ -104,27 +79,97 @@ func (r *IntentRepositoryImpl) SaveIntent(ctx context.Context, intent *models.In
 	createdAt.Time = intent.CreatedAt
 	createdAt.Valid = true
 
-	err := r.queries.SaveIntent(ctx, sqlc.SaveIntentParams{
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.queries.WithTx(tx)
+
+	err = qtx.SaveIntent(ctx, sqlc.SaveIntentParams{
 		ID:         intent.ID,
 		Repository: intent.Repository,
 		Since:      since,
 		CreatedAt:  createdAt,
 		IsActive:   intent.IsActive,
 	})
-	return err
+	if err != nil {
+		return mapError(err)
+	}
+
+	if err := saveOutboxMessages(ctx, qtx, outbox); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *IntentRepositoryImpl) UpdateIntent(ctx context.Context, update *models.IntentUpdate) error {
+// UpdateIntent locks the intent's row for the rest of the transaction, so
+// concurrent updates are applied one after the other.
+func (r *IntentRepositoryImpl) UpdateIntent(ctx context.Context, update *models.IntentUpdate, outbox repository.OutboxFunc) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := r.queries.WithTx(tx)
+
+	row, err := qtx.GetIntentByIdForUpdate(ctx, update.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("intent %s: %w", update.ID, repository.ErrNotFound)
+		}
+		return mapError(err)
+	}
+
+	before := toIntent(row)
+	after := *before
+	update.Apply(&after)
+
 	var since pgtype.Timestamptz
-	if !update.Since.IsZero() {
-		since.Time = *update.Since
+	if !after.Since.IsZero() {
+		since.Time = after.Since
 		since.Valid = true
 	}
 
-	err := r.queries.UpdateIntent(ctx, sqlc.UpdateIntentParams{
+	_, err = qtx.UpdateIntent(ctx, sqlc.UpdateIntentParams{
 		ID:       update.ID,
-		IsActive: update.IsActive,
+		IsActive: after.IsActive,
 		Since:    since,
 	})
-	return err
+	if err != nil {
+		return mapError(err)
+	}
+
+	if outbox != nil {
+		messages, err := outbox(before, &after)
+		if err != nil {
+			return err
+		}
+		if err := saveOutboxMessages(ctx, qtx, messages); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func toIntent(intent sqlc.Intent) *models.Intent {
+	var since, createdAt time.Time
+	if intent.Since.Valid {
+		since = intent.Since.Time
+	}
+	if intent.CreatedAt.Valid {
+		createdAt = intent.CreatedAt.Time
+	}
+
+	return &models.Intent{
+		ID:         intent.ID,
+		Repository: intent.Repository,
+		Since:      since,
+		CreatedAt:  createdAt,
+		IsActive:   intent.IsActive,
+	}
 }
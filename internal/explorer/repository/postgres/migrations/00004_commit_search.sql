@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE commits
+    ADD COLUMN message_tsv TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('english', message)) STORED;
+
+CREATE INDEX commits_message_tsv_idx ON commits USING GIN (message_tsv);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX commits_message_tsv_idx;
+ALTER TABLE commits DROP COLUMN message_tsv;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX commits_repository_created_at_hash_idx
+    ON commits (repository_id, created_at DESC, hash DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX commits_repository_created_at_hash_idx;
+-- +goose StatementEnd
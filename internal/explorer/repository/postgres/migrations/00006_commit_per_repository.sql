@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Hashes are unique across every stored commit so far, so they stay unique
+-- within each repository and the new key can be added without touching data.
+ALTER TABLE commits DROP CONSTRAINT commits_pkey;
+ALTER TABLE commits ADD PRIMARY KEY (repository_id, hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Keep the copy of a shared commit that belongs to the oldest repository.
+DELETE FROM commits c
+USING commits o
+WHERE c.hash = o.hash AND c.repository_id > o.repository_id;
+
+ALTER TABLE commits DROP CONSTRAINT commits_pkey;
+ALTER TABLE commits ADD PRIMARY KEY (hash);
+-- +goose StatementEnd
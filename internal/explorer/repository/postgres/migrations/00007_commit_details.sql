@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Commits stored before this migration keep NULL for what was never fetched.
+ALTER TABLE commits
+    ADD COLUMN authored_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN committer_id BIGINT REFERENCES authors(id),
+    ADD COLUMN parents TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN verified BOOLEAN,
+    ADD COLUMN verification_reason TEXT,
+    ADD COLUMN additions INT,
+    ADD COLUMN deletions INT,
+    ADD COLUMN changed_files INT;
+
+ALTER TABLE commits
+    ADD COLUMN is_merge BOOLEAN
+    GENERATED ALWAYS AS (cardinality(parents) > 1) STORED;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE commits
+    DROP COLUMN is_merge,
+    DROP COLUMN changed_files,
+    DROP COLUMN deletions,
+    DROP COLUMN additions,
+    DROP COLUMN verification_reason,
+    DROP COLUMN verified,
+    DROP COLUMN parents,
+    DROP COLUMN committer_id,
+    DROP COLUMN authored_at;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Authors without a GitHub account all had id 0. The GitHub ID moves to its
+-- own column and id becomes a surrogate key, so those authors are told apart
+-- by email instead.
+ALTER TABLE authors ADD COLUMN github_id BIGINT UNIQUE;
+
+UPDATE authors SET github_id = id WHERE id <> 0;
+
+CREATE UNIQUE INDEX authors_unlinked_email_idx ON authors (email) WHERE github_id IS NULL;
+
+SELECT setval(pg_get_serial_sequence('authors', 'id'), GREATEST((SELECT MAX(id) FROM authors), 1));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX authors_unlinked_email_idx;
+
+ALTER TABLE authors DROP COLUMN github_id;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Failed publishes are counted against the message. A message that keeps
+-- failing is set aside with failed_at so the ones behind it can go ahead; it
+-- stays in the table, with its last error, until someone requeues it by
+-- clearing failed_at.
+ALTER TABLE outbox ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN last_error TEXT;
+ALTER TABLE outbox ADD COLUMN failed_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (created_at) WHERE published_at IS NULL AND failed_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (created_at) WHERE published_at IS NULL;
+
+ALTER TABLE outbox DROP COLUMN failed_at;
+ALTER TABLE outbox DROP COLUMN last_error;
+ALTER TABLE outbox DROP COLUMN attempts;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Processed events are pruned by age.
+CREATE INDEX processed_events_processed_at_idx ON processed_events (processed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX processed_events_processed_at_idx;
+-- +goose StatementEnd
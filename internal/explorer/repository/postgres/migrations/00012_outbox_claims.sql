@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Relays claim messages for a while instead of holding their rows locked in
+-- a transaction while they publish. A message whose claim runs out without a
+-- result is handed out again.
+ALTER TABLE outbox ADD COLUMN claimed_until TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE outbox DROP COLUMN claimed_until;
+-- +goose StatementEnd
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository/postgres/sqlc"
+)
+
+type OutboxRepositoryImpl struct {
+	queries *sqlc.Queries
+}
+
+func newOutboxRepository(pool *pgxpool.Pool) repository.OutboxRepository {
+	return &OutboxRepositoryImpl{queries: sqlc.New(pool)}
+}
+
+func (r *OutboxRepositoryImpl) GetPendingMessages(ctx context.Context, limit int) ([]repository.OutboxMessage, error) {
+	rows, err := r.queries.GetPendingOutboxMessages(ctx, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []repository.OutboxMessage
+	for _, row := range rows {
+		messages = append(messages, toOutboxMessage(row))
+	}
+
+	return messages, nil
+}
+
+// outboxLease is how long claimed messages are kept from other relays. A
+// batch only outlasts it when its publishes hang, and then another relay may
+// publish a message again, which consumers recognise by its event ID.
+const outboxLease = 5 * time.Minute
+
+// ClaimPending claims the messages for outboxLease in a statement of its
+// own, so no connection or row lock is held while handle publishes. Each
+// result is stored as soon as it is known; on a retry the claims on the rest
+// of the batch are given up.
+func (r *OutboxRepositoryImpl) ClaimPending(ctx context.Context, limit int, handle repository.OutboxHandler) (int, error) {
+	rows, err := r.queries.ClaimPendingOutboxMessages(ctx, sqlc.ClaimPendingOutboxMessagesParams{
+		Limit:   int32(limit),
+		Column2: outboxLease.Seconds(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].CreatedAt.Time.Before(rows[j].CreatedAt.Time)
+	})
+
+	for i, row := range rows {
+		result, failure := handle(toOutboxMessage(row))
+
+		var lastError pgtype.Text
+		if failure != nil {
+			lastError = pgtype.Text{String: failure.Error(), Valid: true}
+		}
+
+		switch result {
+		case repository.OutboxPublished:
+			err = r.queries.MarkOutboxMessagePublished(ctx, row.ID)
+		case repository.OutboxRetry:
+			err = r.queries.RecordOutboxMessageFailure(ctx, sqlc.RecordOutboxMessageFailureParams{
+				ID:        row.ID,
+				LastError: lastError,
+			})
+		case repository.OutboxAbandoned:
+			err = r.queries.AbandonOutboxMessage(ctx, sqlc.AbandonOutboxMessageParams{
+				ID:        row.ID,
+				LastError: lastError,
+			})
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to update outbox message %s: %w", row.ID, err)
+		}
+
+		if result == repository.OutboxRetry {
+			var rest []uuid.UUID
+			for _, row := range rows[i+1:] {
+				rest = append(rest, row.ID)
+			}
+			if err := r.queries.ReleaseOutboxMessages(ctx, rest); err != nil {
+				return 0, fmt.Errorf("failed to release outbox messages: %w", err)
+			}
+			break
+		}
+	}
+
+	return len(rows), nil
+}
+
+func toOutboxMessage(row sqlc.Outbox) repository.OutboxMessage {
+	return repository.OutboxMessage{
+		ID:        row.ID,
+		Queue:     row.Queue,
+		Kind:      events.EventKind(row.EventKind),
+		Payload:   row.Payload,
+		CreatedAt: row.CreatedAt.Time,
+		Attempts:  int(row.Attempts),
+	}
+}
+
+// saveOutboxMessages writes messages with the caller's queries, which are
+// expected to be bound to the transaction of the change that produced them.
+func saveOutboxMessages(ctx context.Context, q *sqlc.Queries, messages []repository.OutboxMessage) error {
+	for _, msg := range messages {
+		err := q.SaveOutboxMessage(ctx, sqlc.SaveOutboxMessageParams{
+			ID:        msg.ID,
+			Queue:     msg.Queue,
+			EventKind: string(msg.Kind),
+			Payload:   msg.Payload,
+			CreatedAt: pgtype.Timestamptz{Time: msg.CreatedAt, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save outbox message %s: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
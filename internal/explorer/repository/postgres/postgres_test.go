@@ -2,12 +2,18 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository/postgres"
@@ -32,11 +38,7 @@ func TestMain(m *testing.M) {
 	}
 	defer testDB.Close()
 
-	conn, err := testDB.Acquire(context.Background())
-	if err != nil {
-		log.Fatalln(err)
-	}
-	store, err = postgres.NewStore(conn.Conn())
+	store, err = postgres.NewStore(testDB)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -46,7 +48,7 @@ func TestMain(m *testing.M) {
 
 func clearTables(t *testing.T) {
 	t.Helper()
-	tables := []string{"commits", "repositories", "authors", "intents"}
+	tables := []string{"commits", "repositories", "authors", "intents", "outbox", "processed_events"}
 	_, err := testDB.Exec(context.Background(), "SET CONSTRAINTS ALL DEFERRED;")
 	require.NoError(t, err)
 
@@ -100,6 +102,36 @@ func TestGetRepo(t *testing.T) {
 	assert.Equal(t, repo.FullName, savedRepo.FullName)
 	assert.Equal(t, repo.Language, savedRepo.Language)
 	assert.Equal(t, repo.StarGazers, savedRepo.StarGazers)
+
+	_, err = remoteRepo.GetRepo(context.Background(), "test/missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	clearTables(t)
+}
+
+func TestIntentNotFound(t *testing.T) {
+	intentRepo := store.IntentRepository()
+
+	_, err := intentRepo.GetIntentById(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = intentRepo.GetIntentByRepo(context.Background(), "test/missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	err = intentRepo.UpdateIntent(context.Background(), &models.IntentUpdate{ID: uuid.New()}, nil)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestSaveIntent_Conflict(t *testing.T) {
+	clearTables(t)
+	intentRepo := store.IntentRepository()
+
+	intent := &models.Intent{ID: uuid.New(), Repository: "test/repo", Since: time.Now(), CreatedAt: time.Now(), IsActive: true}
+	require.NoError(t, intentRepo.SaveIntent(context.Background(), intent))
+
+	// The error reaches API clients, so it names no constraint or column.
+	err := intentRepo.SaveIntent(context.Background(), intent)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+	assert.EqualError(t, err, "conflict: intent already exists")
 	clearTables(t)
 }
 
@@ -150,7 +182,7 @@ func TestGetTopCommitters(t *testing.T) {
 		},
 	}
 
-	err = remoteRepo.SaveManyCommit(context.Background(), repo.ID, commits)
+	_, err = remoteRepo.SaveManyCommit(context.Background(), repo.ID, commits)
 	require.NoError(t, err)
 
 	startDate := time.Now().Add(-7 * 24 * time.Hour)
@@ -166,6 +198,732 @@ func TestGetTopCommitters(t *testing.T) {
 	clearTables(t)
 }
 
+func TestGetTopCommitters_LargeHistory(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	alice := models.Author{ID: 1, Name: "Alice", Email: "alice@example.com", Username: "alice"}
+	bob := models.Author{ID: 2, Name: "Bob", Email: "bob@example.com", Username: "bob"}
+	carol := models.Author{ID: 3, Name: "Carol", Email: "carol@example.com", Username: "carol"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Far more commits than a single page of FindCommits, with bob and carol
+	// tied, and each author committing once an hour.
+	var commits []models.Commit
+	for author, count := range map[models.Author]int{alice: 1500, bob: 1200, carol: 1200} {
+		require.NoError(t, remoteRepo.SaveAuthor(ctx, author))
+		for i := 0; i < count; i++ {
+			commits = append(commits, models.Commit{
+				Hash:      fmt.Sprintf("%s-%d", author.Username, i),
+				Message:   "message",
+				Author:    author,
+				CreatedAt: start.Add(time.Duration(i) * time.Hour),
+			})
+		}
+	}
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, commits)
+	require.NoError(t, err)
+
+	stats, err := remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{
+		{Author: alice, Commits: 1500},
+		{Author: bob, Commits: 1200},
+		{Author: carol, Commits: 1200},
+	}, stats)
+
+	stats, err = remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 2, PerPage: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{{Author: bob, Commits: 1200}}, stats)
+
+	// Only the first 1300 hours: alice has 1300 commits in range, the others
+	// all of theirs.
+	end := start.Add(1299 * time.Hour)
+	stats, err = remoteRepo.GetTopCommitters(ctx, "test/repo", &start, &end, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1300), stats[0].Commits)
+
+	// A new name does not make a new committer: carol is counted once, with
+	// the details of her latest commits.
+	renamed := carol
+	renamed.Name = "Carol Smith"
+	var renamedCommits []models.Commit
+	for i := 0; i < 400; i++ {
+		renamedCommits = append(renamedCommits, models.Commit{
+			Hash:      fmt.Sprintf("carol-renamed-%d", i),
+			Message:   "message",
+			Author:    renamed,
+			CreatedAt: start.Add(time.Duration(1200+i) * time.Hour),
+		})
+	}
+	_, err = remoteRepo.SaveManyCommit(ctx, repo.ID, renamedCommits)
+	require.NoError(t, err)
+
+	stats, err = remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{
+		{Author: renamed, Commits: 1600},
+		{Author: alice, Commits: 1500},
+		{Author: bob, Commits: 1200},
+	}, stats)
+
+	buckets, err := remoteRepo.GetCommitActivity(ctx, repository.ActivityFilter{
+		RepositoryName: "test/repo",
+		Interval:       repository.Month,
+		GroupBy:        []repository.GroupAbleCol{repository.CreatedAt, repository.GroupByAuthor},
+	})
+	require.NoError(t, err)
+	perAuthor := make(map[models.Author]int64)
+	for _, bucket := range buckets {
+		perAuthor[*bucket.Author] += bucket.Commits
+	}
+	assert.Equal(t, map[models.Author]int64{alice: 1500, bob: 1200, renamed: 1600}, perAuthor)
+	clearTables(t)
+}
+
+func TestGetTopCommitters_Ties(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	zed := models.Author{ID: 1, Name: "Zed", Email: "zed@example.com", Username: "zed"}
+	amyWork := models.Author{ID: 2, Name: "Amy", Email: "amy@work.example.com", Username: "amy"}
+	amyHome := models.Author{ID: 3, Name: "Amy", Email: "amy@home.example.com", Username: "amy"}
+	var commits []models.Commit
+	for i, author := range []models.Author{zed, amyWork, amyHome} {
+		require.NoError(t, remoteRepo.SaveAuthor(ctx, author))
+		commits = append(commits, models.Commit{
+			Hash:      fmt.Sprintf("hash-%d", i),
+			Message:   "message",
+			Author:    author,
+			CreatedAt: time.Now(),
+		})
+	}
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, commits)
+	require.NoError(t, err)
+
+	// Equal counts are ordered by username, then email, whatever the IDs,
+	// exactly as the in-memory store orders them.
+	stats, err := remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{
+		{Author: amyHome, Commits: 1},
+		{Author: amyWork, Commits: 1},
+		{Author: zed, Commits: 1},
+	}, stats)
+}
+
+func TestGetCommitActivity(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	alice := models.Author{ID: 1, Name: "Alice", Email: "alice@example.com", Username: "alice"}
+	bob := models.Author{ID: 2, Name: "Bob", Email: "bob@example.com", Username: "bob"}
+	require.NoError(t, remoteRepo.SaveAuthor(ctx, alice))
+	require.NoError(t, remoteRepo.SaveAuthor(ctx, bob))
+
+	day := func(d, h int) time.Time { return time.Date(2024, 1, d, h, 0, 0, 0, time.UTC) }
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "1", Message: "one", Author: alice, CreatedAt: day(1, 10)},
+		{Hash: "2", Message: "two", Author: bob, CreatedAt: day(1, 23)},
+		{Hash: "3", Message: "three", Author: alice, CreatedAt: day(3, 12)},
+	})
+	require.NoError(t, err)
+
+	filter := repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Day}
+	buckets, err := remoteRepo.GetCommitActivity(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ActivityBucket{
+		{Start: day(1, 0), Commits: 2},
+		{Start: day(2, 0), Commits: 0},
+		{Start: day(3, 0), Commits: 1},
+	}, buckets)
+
+	// Two hours east of UTC bob's late commit lands on the 2nd.
+	loc, err := time.LoadLocation("Africa/Cairo")
+	require.NoError(t, err)
+	filter.Location = loc
+	buckets, err = remoteRepo.GetCommitActivity(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, buckets, 3)
+	assert.True(t, time.Date(2024, 1, 2, 0, 0, 0, 0, loc).Equal(buckets[1].Start))
+	assert.Equal(t, int64(1), buckets[1].Commits)
+
+	filter.Location = nil
+	filter.GroupBy = []repository.GroupAbleCol{repository.CreatedAt, repository.GroupByAuthor}
+	start, end := day(1, 0), day(2, 0)
+	filter.StartDate, filter.EndDate = &start, &end
+	buckets, err = remoteRepo.GetCommitActivity(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ActivityBucket{
+		{Start: day(1, 0), Author: &alice, Commits: 1},
+		{Start: day(1, 0), Author: &bob, Commits: 1},
+		{Start: day(2, 0), Author: &alice, Commits: 0},
+		{Start: day(2, 0), Author: &bob, Commits: 0},
+	}, buckets)
+
+	first, err := remoteRepo.GetFirstCommitDate(ctx, "test/repo")
+	require.NoError(t, err)
+	require.NotNil(t, first)
+	assert.True(t, day(1, 10).Equal(*first))
+
+	first, err = remoteRepo.GetFirstCommitDate(ctx, "unknown/repo")
+	require.NoError(t, err)
+	assert.Nil(t, first)
+	clearTables(t)
+}
+
+func TestSearchCommits(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	author1 := models.Author{ID: 1, Name: "Author1", Email: "author1@example.com", Username: "author1"}
+	author2 := models.Author{ID: 2, Name: "Author2", Email: "author2@example.com", Username: "author2"}
+	require.NoError(t, remoteRepo.SaveAuthor(ctx, author1))
+	require.NoError(t, remoteRepo.SaveAuthor(ctx, author2))
+
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "1", Message: "Fix crash when parsing empty config files", Author: author1, CreatedAt: jan},
+		{Hash: "2", Message: "Refactor parser", Author: author2, CreatedAt: jan.Add(time.Hour)},
+		{Hash: "3", Message: "Add tests for the config parser", Author: author2, CreatedAt: jan.Add(2 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	pagination := repository.Pagination{Page: 1, PerPage: 10}
+	response, err := remoteRepo.SearchCommits(ctx, "config", repository.CommitsFilter{RepositoryName: "test/repo"}, pagination)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), response.TotalCount)
+	require.Len(t, response.Data, 2)
+	assert.Contains(t, response.Data[0].Highlight, "<mark>config</mark>")
+	assert.Greater(t, response.Data[0].Rank, float32(0))
+
+	// Markup in the message is escaped, only the highlight is a tag.
+	_, err = remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "4", Message: `Escape <script>alert("x")</script> & more`, Author: author1, CreatedAt: jan.Add(3 * time.Hour)},
+	})
+	require.NoError(t, err)
+	response, err = remoteRepo.SearchCommits(ctx, "alert", repository.CommitsFilter{RepositoryName: "test/repo"}, pagination)
+	require.NoError(t, err)
+	require.Len(t, response.Data, 1)
+	assert.Contains(t, response.Data[0].Highlight, "<mark>alert</mark>")
+	assert.NotContains(t, response.Data[0].Highlight, "<script>")
+	assert.Contains(t, response.Data[0].Highlight, "&lt;script&gt;")
+
+	// Stemming matches "parse" with "parsing".
+	response, err = remoteRepo.SearchCommits(ctx, "parse", repository.CommitsFilter{RepositoryName: "test/repo", Author: "author1"}, pagination)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), response.TotalCount)
+
+	end := jan.Add(30 * time.Minute)
+	response, err = remoteRepo.SearchCommits(ctx, "config", repository.CommitsFilter{RepositoryName: "test/repo", EndDate: &end}, pagination)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), response.TotalCount)
+	assert.Equal(t, "1", response.Data[0].Hash)
+	clearTables(t)
+}
+
+func TestSaveManyCommit_Bulk(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	authors := []models.Author{
+		{ID: 1, Name: "Alice", Email: "alice@example.com", Username: "alice"},
+		{ID: 2, Name: "Bob", Email: "bob@example.com", Username: "bob"},
+	}
+	commits := make([]models.Commit, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		commits = append(commits, models.Commit{
+			Hash:      fmt.Sprintf("hash%d", i),
+			Message:   "message",
+			Url:       &url.URL{Scheme: "https", Host: "github.com", Path: fmt.Sprintf("/test/repo/commit/hash%d", i)},
+			Author:    authors[i%2],
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	stats, err := remoteRepo.SaveManyCommit(ctx, repo.ID, commits)
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 5000}, stats)
+
+	// A second delivery of part of the history, with one commit repeated
+	// in the batch and an author who changed their name.
+	renamed := models.Author{ID: 2, Name: "Robert", Email: "bob@example.com", Username: "bob"}
+	again := append([]models.Commit{}, commits[4998:]...)
+	again = append(again, commits[4999], models.Commit{Hash: "new", Message: "message", Author: renamed, CreatedAt: start.Add(-time.Minute)})
+	stats, err = remoteRepo.SaveManyCommit(ctx, repo.ID, again)
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 1, Duplicates: 3}, stats)
+
+	page, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo", Author: "bob"}, repository.Pagination{PerPage: 1, WithTotal: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2501), page.TotalCount)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "Robert", page.Data[0].Author.Name)
+	require.NotNil(t, page.Data[0].Url)
+	assert.Equal(t, "https://github.com/test/repo/commit/hash4999", page.Data[0].Url.String())
+	clearTables(t)
+}
+
+func TestSaveManyCommit_SkipsProcessedEvent(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	author := models.Author{ID: 1, Name: "Alice", Email: "alice@example.com", Username: "alice"}
+	event := repository.ProcessedEvent{ID: uuid.New(), Kind: events.NEW_COMMITS_DATA}
+	commits := []models.Commit{{Hash: "1", Message: "message", Author: author, CreatedAt: time.Now()}}
+
+	stats, err := remoteRepo.SaveManyCommit(ctx, repo.ID, commits, event)
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 1}, stats)
+
+	// The redelivered event writes nothing, not even its new commits.
+	commits = append(commits, models.Commit{Hash: "2", Message: "message", Author: author, CreatedAt: time.Now()})
+	_, err = remoteRepo.SaveManyCommit(ctx, repo.ID, commits, event)
+	assert.ErrorIs(t, err, repository.ErrDuplicateEvent)
+
+	page, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 1)
+	clearTables(t)
+}
+
+func TestSaveManyCommit_Details(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	alice := models.Author{ID: 1, Name: "Alice", Email: "alice@example.com", Username: "alice"}
+	webFlow := models.Author{ID: 19864447, Name: "GitHub", Email: "noreply@github.com", Username: "web-flow"}
+	authored := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	committed := authored.Add(24 * time.Hour)
+
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "1", Message: "initial", Author: alice, CreatedAt: authored, AuthoredAt: authored},
+		{
+			Hash:         "2",
+			Message:      "Merge pull request #1",
+			Author:       alice,
+			AuthoredAt:   authored,
+			Committer:    webFlow,
+			CreatedAt:    committed,
+			Parents:      []string{"1", "0"},
+			Verification: &models.Verification{Verified: true, Reason: "valid"},
+			Stats:        &models.CommitStats{Additions: 10, Deletions: 2, ChangedFiles: 3},
+		},
+	})
+	require.NoError(t, err)
+
+	page, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+
+	merge := page.Data[0]
+	assert.True(t, merge.Merge)
+	assert.Equal(t, []string{"1", "0"}, merge.Parents)
+	assert.Equal(t, webFlow, merge.Committer)
+	assert.True(t, merge.AuthoredAt.Equal(authored))
+	assert.True(t, merge.CreatedAt.Equal(committed))
+	assert.Equal(t, &models.Verification{Verified: true, Reason: "valid"}, merge.Verification)
+	assert.Equal(t, &models.CommitStats{Additions: 10, Deletions: 2, ChangedFiles: 3}, merge.Stats)
+
+	initial := page.Data[1]
+	assert.False(t, initial.Merge)
+	assert.Empty(t, initial.Parents)
+	assert.Equal(t, models.Author{}, initial.Committer)
+	assert.Nil(t, initial.Verification)
+	assert.Nil(t, initial.Stats)
+	clearTables(t)
+}
+
+// Authors without a GitHub account share ID 0 and are told apart by email.
+func TestSaveManyCommit_UnlinkedAuthors(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	alice := models.Author{Name: "Alice", Email: "alice@example.com"}
+	bob := models.Author{Name: "Bob", Email: "bob@example.com"}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "1", Message: "one", Author: alice, CreatedAt: day},
+		{Hash: "2", Message: "two", Author: bob, Committer: alice, CreatedAt: day.Add(time.Hour)},
+		{Hash: "3", Message: "three", Author: alice, CreatedAt: day.Add(2 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	page, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 3)
+	assert.Equal(t, alice, page.Data[0].Author)
+	assert.Equal(t, bob, page.Data[1].Author)
+	assert.Equal(t, alice, page.Data[1].Committer)
+	assert.Equal(t, alice, page.Data[2].Author)
+
+	stats, err := remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{{Author: alice, Commits: 2}, {Author: bob, Commits: 1}}, stats)
+
+	// A later batch finds the same rows by email.
+	_, err = remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "4", Message: "four", Author: bob, CreatedAt: day.Add(3 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	stats, err = remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuthorStats{{Author: alice, Commits: 2}, {Author: bob, Commits: 2}}, stats)
+	clearTables(t)
+}
+
+// A fork shares its upstream's history, and both must keep all of it.
+func TestFork_SharedCommits(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	remoteRepo := store.RemoteRepository()
+	upstream := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	fork := &models.Repository{ID: int64(2), FullName: "fork/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, remoteRepo.SaveRepo(ctx, upstream))
+	require.NoError(t, remoteRepo.SaveRepo(ctx, fork))
+
+	alice := models.Author{ID: 1, Name: "Alice", Email: "alice@example.com", Username: "alice"}
+	bob := models.Author{ID: 2, Name: "Bob", Email: "bob@example.com", Username: "bob"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	shared := []models.Commit{
+		{Hash: "1", Message: "initial", Author: alice, CreatedAt: start},
+		{Hash: "2", Message: "second", Author: alice, CreatedAt: start.Add(time.Hour)},
+	}
+
+	stats, err := remoteRepo.SaveManyCommit(ctx, upstream.ID, shared)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Inserted)
+
+	forked := append([]models.Commit{}, shared...)
+	forked = append(forked, models.Commit{Hash: "3", Message: "fork only", Author: bob, CreatedAt: start.Add(2 * time.Hour)})
+	stats, err = remoteRepo.SaveManyCommit(ctx, fork.ID, forked)
+	require.NoError(t, err)
+	assert.Equal(t, repository.IngestStats{Inserted: 3}, stats)
+
+	page, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10, WithTotal: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), page.TotalCount)
+
+	page, err = remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "fork/repo"}, repository.Pagination{PerPage: 10, WithTotal: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), page.TotalCount)
+	require.Len(t, page.Data, 3)
+	assert.Equal(t, "1", page.Data[2].Hash)
+
+	committers, err := remoteRepo.GetTopCommitters(ctx, "fork/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, committers, 2)
+	assert.Equal(t, "alice", committers[0].Author.Username)
+	assert.Equal(t, int64(2), committers[0].Commits)
+	assert.Equal(t, int64(1), committers[1].Commits)
+
+	committers, err = remoteRepo.GetTopCommitters(ctx, "test/repo", nil, nil, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, committers, 1)
+	assert.Equal(t, int64(2), committers[0].Commits)
+	clearTables(t)
+}
+
+// Handlers and the broker consumer share the store, so it must be safe to
+// use from many goroutines at once.
+func TestStore_ConcurrentAccess(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			author := models.Author{ID: int64(i + 1), Name: "Author", Email: "author@example.com", Username: fmt.Sprintf("author%d", i)}
+			commit := models.Commit{Hash: fmt.Sprintf("hash%d", i), Message: "message", Author: author, CreatedAt: time.Now()}
+			if _, err := remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{commit}); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	page, err := remoteRepo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{PerPage: 10, WithTotal: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), page.TotalCount)
+	clearTables(t)
+}
+
+func TestFindCommits_Keyset(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	author := models.Author{ID: 1, Name: "Author1", Email: "author1@example.com", Username: "author1"}
+	require.NoError(t, remoteRepo.SaveAuthor(ctx, author))
+
+	// Two commits share a timestamp, so the hash has to break the tie.
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, []models.Commit{
+		{Hash: "a", Message: "a", Author: author, CreatedAt: day},
+		{Hash: "b", Message: "b", Author: author, CreatedAt: day.AddDate(0, 0, 1)},
+		{Hash: "c", Message: "c", Author: author, CreatedAt: day.AddDate(0, 0, 1)},
+		{Hash: "d", Message: "d", Author: author, CreatedAt: day.AddDate(0, 0, 2)},
+		{Hash: "e", Message: "e", Author: author, CreatedAt: day.AddDate(0, 0, 3)},
+	})
+	require.NoError(t, err)
+
+	filter := repository.CommitsFilter{RepositoryName: "test/repo"}
+	hashes := func(page repository.PaginatedResponse[models.Commit]) []string {
+		var out []string
+		for _, c := range page.Data {
+			out = append(out, c.Hash)
+		}
+		return out
+	}
+
+	first, err := remoteRepo.FindCommits(ctx, filter, repository.Pagination{PerPage: 2, WithTotal: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e", "d"}, hashes(first))
+	assert.Equal(t, int64(5), first.TotalCount)
+	assert.Empty(t, first.Prev)
+
+	second, err := remoteRepo.FindCommits(ctx, filter, repository.Pagination{PerPage: 2, Cursor: first.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, hashes(second))
+	assert.Zero(t, second.TotalCount)
+
+	last, err := remoteRepo.FindCommits(ctx, filter, repository.Pagination{PerPage: 2, Cursor: second.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, hashes(last))
+	assert.Empty(t, last.Next)
+
+	back, err := remoteRepo.FindCommits(ctx, filter, repository.Pagination{PerPage: 2, Cursor: second.Prev})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e", "d"}, hashes(back))
+	assert.Empty(t, back.Prev)
+	clearTables(t)
+}
+
+func TestSaveIntentWritesOutbox(t *testing.T) {
+	clearTables(t)
+
+	intent := &models.Intent{
+		ID:         uuid.New(),
+		Repository: "test/repo",
+		Since:      time.Now().Add(-24 * time.Hour),
+		CreatedAt:  time.Now(),
+		IsActive:   true,
+	}
+	msg := repository.OutboxMessage{
+		ID:        uuid.New(),
+		Queue:     events.IntentsQueue,
+		Kind:      events.NEW_REPO_INTENT,
+		Payload:   []byte(`{"repository":"test/repo"}`),
+		CreatedAt: time.Now(),
+	}
+
+	err := store.IntentRepository().SaveIntent(context.Background(), intent, msg)
+	require.NoError(t, err)
+
+	pending, err := store.OutboxRepository().GetPendingMessages(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, msg.ID, pending[0].ID)
+	assert.Equal(t, msg.Kind, pending[0].Kind)
+
+	claimed, err := store.OutboxRepository().ClaimPending(context.Background(), 10, func(repository.OutboxMessage) (repository.OutboxResult, error) {
+		return repository.OutboxPublished, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+
+	pending, err = store.OutboxRepository().GetPendingMessages(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	clearTables(t)
+}
+
+func TestPruneProcessedEvents(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+
+	repo := &models.Repository{ID: int64(1), FullName: "test/repo", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	remoteRepo := store.RemoteRepository()
+	require.NoError(t, remoteRepo.SaveRepo(ctx, repo))
+
+	event := repository.ProcessedEvent{ID: uuid.New(), Kind: events.NEW_COMMITS_DATA}
+	_, err := remoteRepo.SaveManyCommit(ctx, repo.ID, nil, event)
+	require.NoError(t, err)
+
+	n, err := remoteRepo.PruneProcessedEvents(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	_, err = remoteRepo.SaveManyCommit(ctx, repo.ID, nil, event)
+	assert.ErrorIs(t, err, repository.ErrDuplicateEvent)
+
+	n, err = remoteRepo.PruneProcessedEvents(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = remoteRepo.SaveManyCommit(ctx, repo.ID, nil, event)
+	assert.NoError(t, err)
+	clearTables(t)
+}
+
+func TestClaimPendingOutbox(t *testing.T) {
+	clearTables(t)
+	ctx := context.Background()
+	outbox := store.OutboxRepository()
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		msg := repository.OutboxMessage{
+			ID:        uuid.New(),
+			Queue:     events.IntentsQueue,
+			Kind:      events.NEW_REPO_INTENT,
+			Payload:   []byte(`{}`),
+			CreatedAt: time.Now().Add(time.Duration(i) * time.Second),
+		}
+		ids = append(ids, msg.ID)
+		intent := &models.Intent{ID: uuid.New(), Repository: fmt.Sprintf("test/repo-%d", i), CreatedAt: time.Now(), IsActive: true}
+		require.NoError(t, store.IntentRepository().SaveIntent(ctx, intent, msg))
+	}
+
+	// Messages held by one caller are skipped by another. A retry keeps the
+	// rest of the batch back.
+	var seen []uuid.UUID
+	claimed, err := outbox.ClaimPending(ctx, 10, func(msg repository.OutboxMessage) (repository.OutboxResult, error) {
+		seen = append(seen, msg.ID)
+
+		n, err := outbox.ClaimPending(ctx, 10, func(repository.OutboxMessage) (repository.OutboxResult, error) {
+			t.Error("claimed a message held by another caller")
+			return repository.OutboxPublished, nil
+		})
+		require.NoError(t, err)
+		assert.Zero(t, n)
+
+		switch msg.ID {
+		case ids[0]:
+			return repository.OutboxPublished, nil
+		default:
+			return repository.OutboxRetry, errors.New("broker down")
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, claimed)
+	assert.Equal(t, ids[:2], seen)
+
+	pending, err := outbox.GetPendingMessages(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, ids[1], pending[0].ID)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, 0, pending[1].Attempts)
+
+	// An abandoned message is no longer pending.
+	_, err = outbox.ClaimPending(ctx, 1, func(repository.OutboxMessage) (repository.OutboxResult, error) {
+		return repository.OutboxAbandoned, errors.New("poison")
+	})
+	require.NoError(t, err)
+
+	pending, err = outbox.GetPendingMessages(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, ids[2], pending[0].ID)
+	clearTables(t)
+}
+
+func TestUpdateIntentWritesOutbox(t *testing.T) {
+	clearTables(t)
+
+	since := time.Now().Add(-24 * time.Hour).UTC().Truncate(time.Microsecond)
+	intent := &models.Intent{
+		ID:         uuid.New(),
+		Repository: "test/repo",
+		Since:      since,
+		CreatedAt:  time.Now(),
+		IsActive:   true,
+	}
+	require.NoError(t, store.IntentRepository().SaveIntent(context.Background(), intent))
+
+	inactive := false
+	msg := repository.OutboxMessage{
+		ID:        uuid.New(),
+		Queue:     events.IntentsQueue,
+		Kind:      events.REPO_INTENT_PAUSED,
+		Payload:   []byte(`{"repository":"test/repo"}`),
+		CreatedAt: time.Now(),
+	}
+	err := store.IntentRepository().UpdateIntent(context.Background(), &models.IntentUpdate{ID: intent.ID, IsActive: &inactive},
+		func(before, after *models.Intent) ([]repository.OutboxMessage, error) {
+			assert.True(t, before.IsActive)
+			assert.False(t, after.IsActive)
+			assert.True(t, since.Equal(after.Since))
+			return []repository.OutboxMessage{msg}, nil
+		})
+	require.NoError(t, err)
+
+	saved, err := store.IntentRepository().GetIntentById(context.Background(), intent.ID)
+	require.NoError(t, err)
+	assert.False(t, saved.IsActive)
+	assert.True(t, since.Equal(saved.Since))
+
+	pending, err := store.OutboxRepository().GetPendingMessages(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, msg.ID, pending[0].ID)
+	clearTables(t)
+}
+
 // func TestSaveManyCommit(t *testing.T) {
 // 	clearTables(t)
 
@@ -207,7 +965,7 @@ func TestGetTopCommitters(t *testing.T) {
 // 		},
 // 	}
 
-// 	err = remoteRepo.SaveManyCommit(context.Background(), repo.ID, commits)
+// 	_, err = remoteRepo.SaveManyCommit(context.Background(), repo.ID, commits)
 // 	require.NoError(t, err)
 
 // 	filter := repository.CommitsFilter{Repository: "test/repo"}
@@ -265,7 +1023,7 @@ func TestGetTopCommitters(t *testing.T) {
 // 		},
 // 	}
 
-// 	err = remoteRepo.SaveManyCommit(context.Background(), repo.ID, commits)
+// 	_, err = remoteRepo.SaveManyCommit(context.Background(), repo.ID, commits)
 // 	require.NoError(t, err)
 
 // 	filter := repository.CommitsFilter{RepositoryName: "test/repo"}
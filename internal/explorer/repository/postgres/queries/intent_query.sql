@@ -12,6 +12,12 @@ SELECT id, repository, since, created_at, is_active
 FROM intents
 WHERE id = $1;
 
+-- name: GetIntentByIdForUpdate :one
+SELECT id, repository, since, created_at, is_active
+FROM intents
+WHERE id = $1
+FOR UPDATE;
+
 -- name: GetIntentByRepoName :one
 SELECT id, repository, since, created_at, is_active
 FROM intents
@@ -22,7 +28,7 @@ SELECT id, repository, since, created_at, is_active
 FROM intents 
 WHERE is_active = COALESCE($1, is_active);
 
--- name: UpdateIntent :exec
+-- name: UpdateIntent :execrows
 UPDATE intents
 SET is_active = COALESCE($2, is_active),
     since = COALESCE($3, since)
@@ -0,0 +1,50 @@
+-- name: SaveOutboxMessage :exec
+INSERT INTO outbox (id, queue, event_kind, payload, created_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetPendingOutboxMessages :many
+SELECT id, queue, event_kind, payload, created_at, published_at, attempts, last_error, failed_at, claimed_until
+FROM outbox
+WHERE published_at IS NULL AND failed_at IS NULL
+ORDER BY created_at
+LIMIT $1;
+
+-- name: ClaimPendingOutboxMessages :many
+UPDATE outbox
+SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $2::float8)
+WHERE id IN (
+    SELECT o.id
+    FROM outbox o
+    WHERE o.published_at IS NULL AND o.failed_at IS NULL
+        AND (o.claimed_until IS NULL OR o.claimed_until < CURRENT_TIMESTAMP)
+    ORDER BY o.created_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, queue, event_kind, payload, created_at, published_at, attempts, last_error, failed_at, claimed_until;
+
+-- name: ReleaseOutboxMessages :exec
+UPDATE outbox
+SET claimed_until = NULL
+WHERE id = ANY($1::uuid[]);
+
+-- name: MarkOutboxMessagePublished :exec
+UPDATE outbox
+SET published_at = CURRENT_TIMESTAMP,
+    claimed_until = NULL
+WHERE id = $1;
+
+-- name: RecordOutboxMessageFailure :exec
+UPDATE outbox
+SET attempts = attempts + 1,
+    last_error = $2,
+    claimed_until = NULL
+WHERE id = $1;
+
+-- name: AbandonOutboxMessage :exec
+UPDATE outbox
+SET attempts = attempts + 1,
+    last_error = $2,
+    failed_at = CURRENT_TIMESTAMP,
+    claimed_until = NULL
+WHERE id = $1;
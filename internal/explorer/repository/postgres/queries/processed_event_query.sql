@@ -0,0 +1,8 @@
+-- name: SaveProcessedEvent :execrows
+INSERT INTO processed_events (id, event_kind)
+VALUES ($1, $2)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: PruneProcessedEvents :execrows
+DELETE FROM processed_events
+WHERE processed_at < $1;
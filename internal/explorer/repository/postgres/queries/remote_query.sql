@@ -16,36 +16,41 @@ WHERE full_name = $1;
 SELECT * FROM authors
 WHERE id = $1;
 
--- name: SaveAuthor :one
-INSERT INTO authors (id, name, email, username)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT (id) DO UPDATE SET
-    name = EXCLUDED.name,
-    email = EXCLUDED.email,
-    username = EXCLUDED.username
-RETURNING *;
-
--- name: SaveCommit :exec
-INSERT INTO commits (hash, author_id, message, url, created_at, repository_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-ON CONFLICT (hash) DO NOTHING;
-
-
 -- name: FindCommits :many
-SELECT 
-    c.hash, c.message, c.url, c.created_at,
-    a.id AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
-    r.id AS repo_id, r.watchers, r.stargazers, r.full_name AS repository, r.created_at AS repo_created_at, 
-    r.updated_at AS repo_updated_at, r.language, r.forks
+SELECT
+    c.hash, c.message, c.url, c.created_at, c.authored_at, c.parents, c.is_merge,
+    c.verified, c.verification_reason, c.additions, c.deletions, c.changed_files,
+    COALESCE(a.github_id, 0)::bigint AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    cm.github_id AS committer_id, cm.name AS committer_name, cm.email AS committer_email, cm.username AS committer_username
 FROM commits c
 JOIN repositories r ON c.repository_id = r.id
 JOIN authors a ON c.author_id = a.id
+LEFT JOIN authors cm ON c.committer_id = cm.id
 WHERE r.full_name = $1
     AND ($2::timestamptz IS NULL OR c.created_at >= $2)
     AND ($3::timestamptz IS NULL OR c.created_at <= $3)
-    AND ($4::text IS NULL OR a.username = $4)
-ORDER BY c.created_at DESC
-LIMIT $5 OFFSET $6;
+    AND (NULLIF($4::text, '') IS NULL OR a.username = $4)
+    AND ($5::timestamptz IS NULL OR (c.created_at, c.hash) < ($5, $6::text))
+ORDER BY c.created_at DESC, c.hash DESC
+LIMIT $7;
+
+-- name: FindNewerCommits :many
+SELECT
+    c.hash, c.message, c.url, c.created_at, c.authored_at, c.parents, c.is_merge,
+    c.verified, c.verification_reason, c.additions, c.deletions, c.changed_files,
+    COALESCE(a.github_id, 0)::bigint AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    cm.github_id AS committer_id, cm.name AS committer_name, cm.email AS committer_email, cm.username AS committer_username
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+JOIN authors a ON c.author_id = a.id
+LEFT JOIN authors cm ON c.committer_id = cm.id
+WHERE r.full_name = $1
+    AND ($2::timestamptz IS NULL OR c.created_at >= $2)
+    AND ($3::timestamptz IS NULL OR c.created_at <= $3)
+    AND (NULLIF($4::text, '') IS NULL OR a.username = $4)
+    AND ((c.created_at, c.hash) > ($5::timestamptz, $6::text))
+ORDER BY c.created_at ASC, c.hash ASC
+LIMIT $7;
 
 
 -- name: CountCommits :one
@@ -56,10 +61,10 @@ JOIN authors a ON c.author_id = a.id
 WHERE r.full_name = $1
     AND ($2::timestamptz IS NULL OR c.created_at >= $2)
     AND ($3::timestamptz IS NULL OR c.created_at <= $3)
-    AND ($4::text IS NULL OR a.username = $4);
+    AND (NULLIF($4::text, '') IS NULL OR a.username = $4);
 
 -- name: GetTopCommitters :many
-SELECT a.id, a.name, a.email, a.username, COUNT(c.hash) as commit_count
+SELECT COALESCE(a.github_id, 0)::bigint AS id, a.name, a.email, a.username, COUNT(c.hash) as commit_count
 FROM authors a
 JOIN commits c ON a.id = c.author_id
 JOIN repositories r ON c.repository_id = r.id
@@ -67,11 +72,97 @@ WHERE r.full_name = $1
     AND ($2::timestamptz IS NULL OR c.created_at >= $2)
     AND ($3::timestamptz IS NULL OR c.created_at <= $3)
 GROUP BY a.id, a.name, a.email, a.username
-ORDER BY commit_count DESC
+ORDER BY commit_count DESC, COALESCE(a.username, '') COLLATE "C", COALESCE(a.email, '') COLLATE "C", COALESCE(a.github_id, 0)
 LIMIT $4 OFFSET $5;
 
--- name: SaveManyCommits :many
-INSERT INTO commits (hash, author_id, message, url, created_at, repository_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-ON CONFLICT (hash) DO NOTHING
-RETURNING *;
\ No newline at end of file
+-- name: GetCommitActivity :many
+WITH filtered AS (
+    SELECT date_trunc($4::text, c.created_at AT TIME ZONE $5::text) AS bucket,
+        CASE WHEN $6::boolean THEN c.author_id END AS author_id
+    FROM commits c
+    JOIN repositories r ON c.repository_id = r.id
+    WHERE r.full_name = $1
+        AND ($2::timestamptz IS NULL OR c.created_at >= $2)
+        AND ($3::timestamptz IS NULL OR c.created_at <= $3)
+),
+series AS (
+    SELECT generate_series(
+        date_trunc($4::text, COALESCE($2::timestamptz AT TIME ZONE $5::text, (SELECT MIN(bucket) FROM filtered))),
+        date_trunc($4::text, COALESCE($3::timestamptz AT TIME ZONE $5::text, (SELECT MAX(bucket) FROM filtered))),
+        ('1 ' || $4::text)::interval
+    ) AS bucket
+),
+groups AS (
+    SELECT DISTINCT author_id FROM filtered
+    UNION
+    SELECT NULL::bigint WHERE NOT $6::boolean
+)
+SELECT (s.bucket AT TIME ZONE $5::text)::timestamptz AS bucket_start,
+    g.author_id, a.github_id AS author_github_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    COUNT(f.bucket) AS commit_count
+FROM series s
+CROSS JOIN groups g
+LEFT JOIN filtered f ON f.bucket = s.bucket AND f.author_id IS NOT DISTINCT FROM g.author_id
+LEFT JOIN authors a ON a.id = g.author_id
+GROUP BY s.bucket, g.author_id, a.github_id, a.name, a.email, a.username
+ORDER BY s.bucket, COALESCE(a.username, '') COLLATE "C", COALESCE(a.email, '') COLLATE "C", COALESCE(a.github_id, 0);
+
+-- name: GetFirstCommitDate :one
+SELECT MIN(c.created_at)::timestamptz AS first_commit_date
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+WHERE r.full_name = $1;
+
+-- name: SearchCommits :many
+SELECT
+    c.hash, c.message, c.url, c.created_at, c.authored_at, c.parents, c.is_merge,
+    c.verified, c.verification_reason, c.additions, c.deletions, c.changed_files,
+    COALESCE(a.github_id, 0)::bigint AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    cm.github_id AS committer_id, cm.name AS committer_name, cm.email AS committer_email, cm.username AS committer_username,
+    ts_rank(c.message_tsv, query) AS rank,
+    ts_headline('english',
+        replace(replace(replace(replace(replace(c.message, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'),
+        query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2') AS highlight
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+JOIN authors a ON c.author_id = a.id
+LEFT JOIN authors cm ON c.committer_id = cm.id
+CROSS JOIN websearch_to_tsquery('english', $2) query
+WHERE r.full_name = $1
+    AND c.message_tsv @@ query
+    AND ($3::timestamptz IS NULL OR c.created_at >= $3)
+    AND ($4::timestamptz IS NULL OR c.created_at <= $4)
+    AND (NULLIF($5::text, '') IS NULL OR a.username = $5)
+ORDER BY rank DESC, c.created_at DESC, c.hash
+LIMIT $6 OFFSET $7;
+
+-- name: CountSearchCommits :one
+SELECT COUNT(*)
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+JOIN authors a ON c.author_id = a.id
+CROSS JOIN websearch_to_tsquery('english', $2) query
+WHERE r.full_name = $1
+    AND c.message_tsv @@ query
+    AND ($3::timestamptz IS NULL OR c.created_at >= $3)
+    AND ($4::timestamptz IS NULL OR c.created_at <= $4)
+    AND (NULLIF($5::text, '') IS NULL OR a.username = $5);
+
+-- name: UpsertLinkedAuthors :many
+INSERT INTO authors (github_id, name, email, username)
+SELECT github_id, name, email, username
+FROM unnest($1::bigint[], $2::text[], $3::text[], $4::text[]) AS a (github_id, name, email, username)
+ON CONFLICT (github_id) DO UPDATE SET
+    name = EXCLUDED.name,
+    email = EXCLUDED.email,
+    username = EXCLUDED.username
+RETURNING id, github_id;
+
+-- name: UpsertUnlinkedAuthors :many
+INSERT INTO authors (name, email, username)
+SELECT name, email, username
+FROM unnest($1::text[], $2::text[], $3::text[]) AS a (name, email, username)
+ON CONFLICT (email) WHERE github_id IS NULL DO UPDATE SET
+    name = EXCLUDED.name,
+    username = EXCLUDED.username
+RETURNING id, email;
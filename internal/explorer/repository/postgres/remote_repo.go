@@ -9,6 +9,7 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository/postgres/sqlc"
@@ -16,57 +17,11 @@ import (
 
 type RemoteRepositoryImpl struct {
 	queries *sqlc.Queries
-	conn    *pgx.Conn
+	pool    *pgxpool.Pool
 }
 
-func (r *RemoteRepositoryImpl) SaveManyCommit(ctx context.Context, repoID int64, commits []models.Commit) error {
-	tx, err := r.conn.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	qtx := r.queries.WithTx(tx)
-
-	for _, commit := range commits {
-		author, err := qtx.GetAuthor(ctx, commit.Author.ID)
-		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-			continue
-		}
-
-		if errors.Is(err, pgx.ErrNoRows) {
-			author, err = qtx.SaveAuthor(ctx, sqlc.SaveAuthorParams{
-				ID:       commit.Author.ID,
-				Name:     commit.Author.Name,
-				Email:    commit.Author.Email,
-				Username: commit.Author.Username,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to save author %s: %w", commit.Author.Username, err)
-			}
-		}
-
-		err = qtx.SaveCommit(ctx, sqlc.SaveCommitParams{
-			Hash:         commit.Hash,
-			AuthorID:     author.ID,
-			CreatedAt:    pgtype.Timestamptz{Time: commit.CreatedAt, Valid: true},
-			Message:      commit.Message,
-			RepositoryID: repoID,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to save commit %s: %w", commit.Hash, err)
-		}
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
-}
-
-func newRemoteRepository(conn *pgx.Conn) repository.RemoteRepository {
-	return &RemoteRepositoryImpl{queries: sqlc.New(conn), conn: conn}
+func newRemoteRepository(pool *pgxpool.Pool) repository.RemoteRepository {
+	return &RemoteRepositoryImpl{queries: sqlc.New(pool), pool: pool}
 }
 
 func (r *RemoteRepositoryImpl) SaveRepo(ctx context.Context, repo *models.Repository) error {
@@ -76,7 +31,7 @@ func (r *RemoteRepositoryImpl) SaveRepo(ctx context.Context, repo *models.Reposi
 	updatedAt.Time = repo.UpdatedAt
 	updatedAt.Valid = true
 
-	return r.queries.SaveRepo(ctx, sqlc.SaveRepoParams{
+	err := r.queries.SaveRepo(ctx, sqlc.SaveRepoParams{
 		ID:         repo.ID,
 		Watchers:   int32(repo.Watchers),
 		Stargazers: int32(repo.StarGazers),
@@ -86,11 +41,15 @@ func (r *RemoteRepositoryImpl) SaveRepo(ctx context.Context, repo *models.Reposi
 		Language:   pgtype.Text{String: repo.Language, Valid: true},
 		Forks:      int32(repo.Forks),
 	})
+	return mapError(err)
 }
 
 func (r *RemoteRepositoryImpl) GetRepo(ctx context.Context, name string) (*models.Repository, error) {
 	repo, err := r.queries.GetRepo(ctx, name)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("repository %s: %w", name, repository.ErrNotFound)
+		}
 		return nil, err
 	}
 
@@ -121,56 +80,160 @@ func (r *RemoteRepositoryImpl) FindCommits(ctx context.Context, filter repositor
 		endDate.Valid = true
 	}
 
-	// Execute the FindCommits query
-	rows, err := r.queries.FindCommits(ctx, sqlc.FindCommitsParams{
-		FullName: filter.RepositoryName,
-		Column2:  startDate,
-		Column3:  endDate,
-		Limit:    int32(pagination.PerPage),
-		Offset:   int32((pagination.Page - 1) * pagination.PerPage),
-	})
+	cursor, err := repository.DecodeCursor(pagination.Cursor)
 	if err != nil {
 		return repository.PaginatedResponse[models.Commit]{}, err
 	}
 
+	var after pgtype.Timestamptz
+	var afterHash string
+	if cursor != nil {
+		after = pgtype.Timestamptz{Time: cursor.CreatedAt, Valid: true}
+		afterHash = cursor.Hash
+	}
+
+	// Fetch one row more than asked for to know whether another page follows.
+	var rows []sqlc.FindCommitsRow
+	if cursor != nil && cursor.Backward {
+		newer, err := r.queries.FindNewerCommits(ctx, sqlc.FindNewerCommitsParams{
+			FullName: filter.RepositoryName,
+			Column2:  startDate,
+			Column3:  endDate,
+			Column4:  filter.Author,
+			Column5:  after,
+			Column6:  afterHash,
+			Limit:    int32(pagination.PerPage + 1),
+		})
+		if err != nil {
+			return repository.PaginatedResponse[models.Commit]{}, err
+		}
+		for _, row := range newer {
+			rows = append(rows, sqlc.FindCommitsRow(row))
+		}
+	} else {
+		rows, err = r.queries.FindCommits(ctx, sqlc.FindCommitsParams{
+			FullName: filter.RepositoryName,
+			Column2:  startDate,
+			Column3:  endDate,
+			Column4:  filter.Author,
+			Column5:  after,
+			Column6:  afterHash,
+			Limit:    int32(pagination.PerPage + 1),
+		})
+		if err != nil {
+			return repository.PaginatedResponse[models.Commit]{}, err
+		}
+	}
+
 	var commits []models.Commit
 	for _, row := range rows {
 		commits = append(commits, models.Commit{
-			Hash:      row.Hash,
-			Message:   row.Message,
-			Url:       parseURL(row.Url),
-			CreatedAt: row.CreatedAt.Time,
-			Repository: models.Repository{
-				ID:         row.RepoID,
-				Watchers:   row.Watchers,
-				StarGazers: row.Stargazers,
-				FullName:   row.Repository,
-				CreatedAt:  row.RepoCreatedAt.Time,
-				UpdatedAt:  row.RepoUpdatedAt.Time,
-				Language:   row.Language.String,
-				Forks:      row.Forks,
-			},
+			Hash:       row.Hash,
+			Message:    row.Message,
+			Url:        parseURL(row.Url),
+			CreatedAt:  row.CreatedAt.Time,
+			AuthoredAt: row.AuthoredAt.Time,
 			Author: models.Author{
 				ID:       row.AuthorID,
 				Name:     row.AuthorName,
 				Email:    row.AuthorEmail,
 				Username: row.AuthorUsername,
 			},
+			Committer:    committer(row.CommitterID, row.CommitterName, row.CommitterEmail, row.CommitterUsername),
+			Parents:      row.Parents,
+			Merge:        row.IsMerge.Bool,
+			Verification: verification(row.Verified, row.VerificationReason),
+			Stats:        commitStats(row.Additions, row.Deletions, row.ChangedFiles),
 		})
 	}
 
-	// Get the total count of commits matching the filter
-	totalCount, err := r.queries.CountCommits(ctx, sqlc.CountCommitsParams{
+	page := repository.KeysetPage(commits, pagination.PerPage, cursor, commitKey)
+	if !pagination.WithTotal {
+		return page, nil
+	}
+
+	// Counting every matching commit is costly, so only done when asked for.
+	page.TotalCount, err = r.queries.CountCommits(ctx, sqlc.CountCommitsParams{
 		FullName: filter.RepositoryName,
 		Column2:  startDate,
 		Column3:  endDate,
+		Column4:  filter.Author,
 	})
 	if err != nil {
 		return repository.PaginatedResponse[models.Commit]{}, err
 	}
+	return page, nil
+}
+
+func commitKey(c models.Commit) (time.Time, string) {
+	return c.CreatedAt, c.Hash
+}
+
+// SearchCommits runs query through websearch_to_tsquery, so it accepts quoted
+// phrases, "or" and "-" for negation.
+func (r *RemoteRepositoryImpl) SearchCommits(ctx context.Context, query string, filter repository.CommitsFilter, pagination repository.Pagination) (repository.PaginatedResponse[models.CommitMatch], error) {
+	var startDate, endDate pgtype.Timestamptz
+	if filter.StartDate != nil && !filter.StartDate.IsZero() {
+		startDate.Time = *filter.StartDate
+		startDate.Valid = true
+	}
+	if filter.EndDate != nil && !filter.EndDate.IsZero() {
+		endDate.Time = *filter.EndDate
+		endDate.Valid = true
+	}
 
-	return repository.PaginatedResponse[models.Commit]{
-		Data:       commits,
+	rows, err := r.queries.SearchCommits(ctx, sqlc.SearchCommitsParams{
+		FullName:           filter.RepositoryName,
+		WebsearchToTsquery: query,
+		Column3:            startDate,
+		Column4:            endDate,
+		Column5:            filter.Author,
+		Limit:              int32(pagination.PerPage),
+		Offset:             int32((pagination.Page - 1) * pagination.PerPage),
+	})
+	if err != nil {
+		return repository.PaginatedResponse[models.CommitMatch]{}, mapError(err)
+	}
+
+	var matches []models.CommitMatch
+	for _, row := range rows {
+		matches = append(matches, models.CommitMatch{
+			Commit: models.Commit{
+				Hash:       row.Hash,
+				Message:    row.Message,
+				Url:        parseURL(row.Url),
+				CreatedAt:  row.CreatedAt.Time,
+				AuthoredAt: row.AuthoredAt.Time,
+				Author: models.Author{
+					ID:       row.AuthorID,
+					Name:     row.AuthorName,
+					Email:    row.AuthorEmail,
+					Username: row.AuthorUsername,
+				},
+				Committer:    committer(row.CommitterID, row.CommitterName, row.CommitterEmail, row.CommitterUsername),
+				Parents:      row.Parents,
+				Merge:        row.IsMerge.Bool,
+				Verification: verification(row.Verified, row.VerificationReason),
+				Stats:        commitStats(row.Additions, row.Deletions, row.ChangedFiles),
+			},
+			Rank:      row.Rank,
+			Highlight: row.Highlight,
+		})
+	}
+
+	totalCount, err := r.queries.CountSearchCommits(ctx, sqlc.CountSearchCommitsParams{
+		FullName:           filter.RepositoryName,
+		WebsearchToTsquery: query,
+		Column3:            startDate,
+		Column4:            endDate,
+		Column5:            filter.Author,
+	})
+	if err != nil {
+		return repository.PaginatedResponse[models.CommitMatch]{}, err
+	}
+
+	return repository.PaginatedResponse[models.CommitMatch]{
+		Data:       matches,
 		TotalCount: totalCount,
 		Page:       pagination.Page,
 		PerPage:    pagination.PerPage,
@@ -179,11 +242,11 @@ func (r *RemoteRepositoryImpl) FindCommits(ctx context.Context, filter repositor
 
 func (r *RemoteRepositoryImpl) GetTopCommitters(ctx context.Context, repository string, startDate, endDate *time.Time, pagination repository.Pagination) ([]models.AuthorStats, error) {
 	var start, end pgtype.Timestamptz
-	if startDate != nil {
+	if startDate != nil && !startDate.IsZero() {
 		start.Time = *startDate
 		start.Valid = true
 	}
-	if endDate != nil {
+	if endDate != nil && !endDate.IsZero() {
 		end.Time = *endDate
 		end.Valid = true
 	}
@@ -215,13 +278,67 @@ func (r *RemoteRepositoryImpl) GetTopCommitters(ctx context.Context, repository
 	return stats, nil
 }
 
-func (r *RemoteRepositoryImpl) SaveAuthor(ctx context.Context, author models.Author) error {
-	_, err := r.queries.SaveAuthor(ctx, sqlc.SaveAuthorParams{
-		ID:       author.ID,
-		Name:     author.Name,
-		Email:    author.Email,
-		Username: author.Username,
+func (r *RemoteRepositoryImpl) GetFirstCommitDate(ctx context.Context, repository string) (*time.Time, error) {
+	first, err := r.queries.GetFirstCommitDate(ctx, repository)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if !first.Valid {
+		return nil, nil
+	}
+	return &first.Time, nil
+}
+
+func (r *RemoteRepositoryImpl) GetCommitActivity(ctx context.Context, filter repository.ActivityFilter) ([]models.ActivityBucket, error) {
+	var start, end pgtype.Timestamptz
+	if filter.StartDate != nil && !filter.StartDate.IsZero() {
+		start.Time = *filter.StartDate
+		start.Valid = true
+	}
+	if filter.EndDate != nil && !filter.EndDate.IsZero() {
+		end.Time = *filter.EndDate
+		end.Valid = true
+	}
+
+	loc := filter.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	rows, err := r.queries.GetCommitActivity(ctx, sqlc.GetCommitActivityParams{
+		FullName: filter.RepositoryName,
+		Column2:  start,
+		Column3:  end,
+		Column4:  string(filter.Interval),
+		Column5:  loc.String(),
+		Column6:  filter.ByAuthor(),
 	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	buckets := make([]models.ActivityBucket, 0, len(rows))
+	for _, row := range rows {
+		bucket := models.ActivityBucket{
+			Start:   row.BucketStart.Time.In(loc),
+			Commits: row.CommitCount,
+		}
+		if row.AuthorID.Valid {
+			bucket.Author = &models.Author{
+				ID:       row.AuthorGithubID.Int64,
+				Name:     row.AuthorName.String,
+				Email:    row.AuthorEmail.String,
+				Username: row.AuthorUsername.String,
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
+
+func (r *RemoteRepositoryImpl) SaveAuthor(ctx context.Context, author models.Author) error {
+	_, err := saveAuthors(ctx, r.queries, []models.Author{author})
 	return err
 }
 
@@ -240,3 +357,36 @@ func parseURL(rawURL pgtype.Text) *url.URL {
 	}
 	return nil
 }
+
+// committer is left empty for commits stored before committers were kept,
+// and has a zero ID without a GitHub account.
+func committer(id pgtype.Int8, name, email, username pgtype.Text) models.Author {
+	if !name.Valid {
+		return models.Author{}
+	}
+	return models.Author{
+		ID:       id.Int64,
+		Name:     name.String,
+		Email:    email.String,
+		Username: username.String,
+	}
+}
+
+func verification(verified pgtype.Bool, reason pgtype.Text) *models.Verification {
+	if !verified.Valid {
+		return nil
+	}
+	return &models.Verification{Verified: verified.Bool, Reason: reason.String}
+}
+
+// commitStats is nil unless the commit was fetched with its details.
+func commitStats(additions, deletions, changedFiles pgtype.Int4) *models.CommitStats {
+	if !additions.Valid {
+		return nil
+	}
+	return &models.CommitStats{
+		Additions:    int(additions.Int32),
+		Deletions:    int(deletions.Int32),
+		ChangedFiles: int(changedFiles.Int32),
+	}
+}
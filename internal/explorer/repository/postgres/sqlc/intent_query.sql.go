@@ -31,6 +31,26 @@ func (q *Queries) GetIntentById(ctx context.Context, id uuid.UUID) (Intent, erro
 	return i, err
 }
 
+const getIntentByIdForUpdate = `-- name: GetIntentByIdForUpdate :one
+SELECT id, repository, since, created_at, is_active
+FROM intents
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetIntentByIdForUpdate(ctx context.Context, id uuid.UUID) (Intent, error) {
+	row := q.db.QueryRow(ctx, getIntentByIdForUpdate, id)
+	var i Intent
+	err := row.Scan(
+		&i.ID,
+		&i.Repository,
+		&i.Since,
+		&i.CreatedAt,
+		&i.IsActive,
+	)
+	return i, err
+}
+
 const getIntentByRepoName = `-- name: GetIntentByRepoName :one
 SELECT id, repository, since, created_at, is_active
 FROM intents
@@ -111,7 +131,7 @@ func (q *Queries) SaveIntent(ctx context.Context, arg SaveIntentParams) error {
 	return err
 }
 
-const updateIntent = `-- name: UpdateIntent :exec
+const updateIntent = `-- name: UpdateIntent :execrows
 UPDATE intents
 SET is_active = COALESCE($2, is_active),
     since = COALESCE($3, since)
@@ -124,7 +144,10 @@ type UpdateIntentParams struct {
 	Since    pgtype.Timestamptz
 }
 
-func (q *Queries) UpdateIntent(ctx context.Context, arg UpdateIntentParams) error {
-	_, err := q.db.Exec(ctx, updateIntent, arg.ID, arg.IsActive, arg.Since)
-	return err
+func (q *Queries) UpdateIntent(ctx context.Context, arg UpdateIntentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateIntent, arg.ID, arg.IsActive, arg.Since)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
@@ -14,15 +14,26 @@ type Author struct {
 	Name     string
 	Email    string
 	Username string
+	GithubID pgtype.Int8
 }
 
 type Commit struct {
-	Hash         string
-	AuthorID     int64
-	Message      string
-	Url          pgtype.Text
-	CreatedAt    pgtype.Timestamptz
-	RepositoryID int64
+	Hash               string
+	AuthorID           int64
+	Message            string
+	Url                pgtype.Text
+	CreatedAt          pgtype.Timestamptz
+	RepositoryID       int64
+	MessageTsv         interface{}
+	AuthoredAt         pgtype.Timestamptz
+	CommitterID        pgtype.Int8
+	Parents            []string
+	Verified           pgtype.Bool
+	VerificationReason pgtype.Text
+	Additions          pgtype.Int4
+	Deletions          pgtype.Int4
+	ChangedFiles       pgtype.Int4
+	IsMerge            pgtype.Bool
 }
 
 type Intent struct {
@@ -33,6 +44,25 @@ type Intent struct {
 	IsActive   bool
 }
 
+type Outbox struct {
+	ID           uuid.UUID
+	Queue        string
+	EventKind    string
+	Payload      []byte
+	CreatedAt    pgtype.Timestamptz
+	PublishedAt  pgtype.Timestamptz
+	Attempts     int32
+	LastError    pgtype.Text
+	FailedAt     pgtype.Timestamptz
+	ClaimedUntil pgtype.Timestamptz
+}
+
+type ProcessedEvent struct {
+	ID          uuid.UUID
+	EventKind   string
+	ProcessedAt pgtype.Timestamptz
+}
+
 type Repository struct {
 	ID         int64
 	Watchers   int32
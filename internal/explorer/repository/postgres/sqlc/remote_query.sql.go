@@ -19,7 +19,7 @@ JOIN authors a ON c.author_id = a.id
 WHERE r.full_name = $1
     AND ($2::timestamptz IS NULL OR c.created_at >= $2)
     AND ($3::timestamptz IS NULL OR c.created_at <= $3)
-    AND ($4::text IS NULL OR a.username = $4)
+    AND (NULLIF($4::text, '') IS NULL OR a.username = $4)
 `
 
 type CountCommitsParams struct {
@@ -41,21 +41,57 @@ func (q *Queries) CountCommits(ctx context.Context, arg CountCommitsParams) (int
 	return count, err
 }
 
+const countSearchCommits = `-- name: CountSearchCommits :one
+SELECT COUNT(*)
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+JOIN authors a ON c.author_id = a.id
+CROSS JOIN websearch_to_tsquery('english', $2) query
+WHERE r.full_name = $1
+    AND c.message_tsv @@ query
+    AND ($3::timestamptz IS NULL OR c.created_at >= $3)
+    AND ($4::timestamptz IS NULL OR c.created_at <= $4)
+    AND (NULLIF($5::text, '') IS NULL OR a.username = $5)
+`
+
+type CountSearchCommitsParams struct {
+	FullName           string
+	WebsearchToTsquery string
+	Column3            pgtype.Timestamptz
+	Column4            pgtype.Timestamptz
+	Column5            string
+}
+
+func (q *Queries) CountSearchCommits(ctx context.Context, arg CountSearchCommitsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countSearchCommits,
+		arg.FullName,
+		arg.WebsearchToTsquery,
+		arg.Column3,
+		arg.Column4,
+		arg.Column5,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const findCommits = `-- name: FindCommits :many
-SELECT 
-    c.hash, c.message, c.url, c.created_at,
-    a.id AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
-    r.id AS repo_id, r.watchers, r.stargazers, r.full_name AS repository, r.created_at AS repo_created_at, 
-    r.updated_at AS repo_updated_at, r.language, r.forks
+SELECT
+    c.hash, c.message, c.url, c.created_at, c.authored_at, c.parents, c.is_merge,
+    c.verified, c.verification_reason, c.additions, c.deletions, c.changed_files,
+    COALESCE(a.github_id, 0)::bigint AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    cm.github_id AS committer_id, cm.name AS committer_name, cm.email AS committer_email, cm.username AS committer_username
 FROM commits c
 JOIN repositories r ON c.repository_id = r.id
 JOIN authors a ON c.author_id = a.id
+LEFT JOIN authors cm ON c.committer_id = cm.id
 WHERE r.full_name = $1
     AND ($2::timestamptz IS NULL OR c.created_at >= $2)
     AND ($3::timestamptz IS NULL OR c.created_at <= $3)
-    AND ($4::text IS NULL OR a.username = $4)
-ORDER BY c.created_at DESC
-LIMIT $5 OFFSET $6
+    AND (NULLIF($4::text, '') IS NULL OR a.username = $4)
+    AND ($5::timestamptz IS NULL OR (c.created_at, c.hash) < ($5, $6::text))
+ORDER BY c.created_at DESC, c.hash DESC
+LIMIT $7
 `
 
 type FindCommitsParams struct {
@@ -63,27 +99,32 @@ type FindCommitsParams struct {
 	Column2  pgtype.Timestamptz
 	Column3  pgtype.Timestamptz
 	Column4  string
+	Column5  pgtype.Timestamptz
+	Column6  string
 	Limit    int32
-	Offset   int32
 }
 
 type FindCommitsRow struct {
-	Hash           string
-	Message        string
-	Url            pgtype.Text
-	CreatedAt      pgtype.Timestamptz
-	AuthorID       int64
-	AuthorName     string
-	AuthorEmail    string
-	AuthorUsername string
-	RepoID         int64
-	Watchers       int32
-	Stargazers     int32
-	Repository     string
-	RepoCreatedAt  pgtype.Timestamptz
-	RepoUpdatedAt  pgtype.Timestamptz
-	Language       pgtype.Text
-	Forks          int32
+	Hash               string
+	Message            string
+	Url                pgtype.Text
+	CreatedAt          pgtype.Timestamptz
+	AuthoredAt         pgtype.Timestamptz
+	Parents            []string
+	IsMerge            pgtype.Bool
+	Verified           pgtype.Bool
+	VerificationReason pgtype.Text
+	Additions          pgtype.Int4
+	Deletions          pgtype.Int4
+	ChangedFiles       pgtype.Int4
+	AuthorID           int64
+	AuthorName         string
+	AuthorEmail        string
+	AuthorUsername     string
+	CommitterID        pgtype.Int8
+	CommitterName      pgtype.Text
+	CommitterEmail     pgtype.Text
+	CommitterUsername  pgtype.Text
 }
 
 func (q *Queries) FindCommits(ctx context.Context, arg FindCommitsParams) ([]FindCommitsRow, error) {
@@ -92,8 +133,9 @@ func (q *Queries) FindCommits(ctx context.Context, arg FindCommitsParams) ([]Fin
 		arg.Column2,
 		arg.Column3,
 		arg.Column4,
+		arg.Column5,
+		arg.Column6,
 		arg.Limit,
-		arg.Offset,
 	)
 	if err != nil {
 		return nil, err
@@ -107,18 +149,123 @@ func (q *Queries) FindCommits(ctx context.Context, arg FindCommitsParams) ([]Fin
 			&i.Message,
 			&i.Url,
 			&i.CreatedAt,
+			&i.AuthoredAt,
+			&i.Parents,
+			&i.IsMerge,
+			&i.Verified,
+			&i.VerificationReason,
+			&i.Additions,
+			&i.Deletions,
+			&i.ChangedFiles,
 			&i.AuthorID,
 			&i.AuthorName,
 			&i.AuthorEmail,
 			&i.AuthorUsername,
-			&i.RepoID,
-			&i.Watchers,
-			&i.Stargazers,
-			&i.Repository,
-			&i.RepoCreatedAt,
-			&i.RepoUpdatedAt,
-			&i.Language,
-			&i.Forks,
+			&i.CommitterID,
+			&i.CommitterName,
+			&i.CommitterEmail,
+			&i.CommitterUsername,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findNewerCommits = `-- name: FindNewerCommits :many
+SELECT
+    c.hash, c.message, c.url, c.created_at, c.authored_at, c.parents, c.is_merge,
+    c.verified, c.verification_reason, c.additions, c.deletions, c.changed_files,
+    COALESCE(a.github_id, 0)::bigint AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    cm.github_id AS committer_id, cm.name AS committer_name, cm.email AS committer_email, cm.username AS committer_username
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+JOIN authors a ON c.author_id = a.id
+LEFT JOIN authors cm ON c.committer_id = cm.id
+WHERE r.full_name = $1
+    AND ($2::timestamptz IS NULL OR c.created_at >= $2)
+    AND ($3::timestamptz IS NULL OR c.created_at <= $3)
+    AND (NULLIF($4::text, '') IS NULL OR a.username = $4)
+    AND ((c.created_at, c.hash) > ($5::timestamptz, $6::text))
+ORDER BY c.created_at ASC, c.hash ASC
+LIMIT $7
+`
+
+type FindNewerCommitsParams struct {
+	FullName string
+	Column2  pgtype.Timestamptz
+	Column3  pgtype.Timestamptz
+	Column4  string
+	Column5  pgtype.Timestamptz
+	Column6  string
+	Limit    int32
+}
+
+type FindNewerCommitsRow struct {
+	Hash               string
+	Message            string
+	Url                pgtype.Text
+	CreatedAt          pgtype.Timestamptz
+	AuthoredAt         pgtype.Timestamptz
+	Parents            []string
+	IsMerge            pgtype.Bool
+	Verified           pgtype.Bool
+	VerificationReason pgtype.Text
+	Additions          pgtype.Int4
+	Deletions          pgtype.Int4
+	ChangedFiles       pgtype.Int4
+	AuthorID           int64
+	AuthorName         string
+	AuthorEmail        string
+	AuthorUsername     string
+	CommitterID        pgtype.Int8
+	CommitterName      pgtype.Text
+	CommitterEmail     pgtype.Text
+	CommitterUsername  pgtype.Text
+}
+
+func (q *Queries) FindNewerCommits(ctx context.Context, arg FindNewerCommitsParams) ([]FindNewerCommitsRow, error) {
+	rows, err := q.db.Query(ctx, findNewerCommits,
+		arg.FullName,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+		arg.Column5,
+		arg.Column6,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindNewerCommitsRow
+	for rows.Next() {
+		var i FindNewerCommitsRow
+		if err := rows.Scan(
+			&i.Hash,
+			&i.Message,
+			&i.Url,
+			&i.CreatedAt,
+			&i.AuthoredAt,
+			&i.Parents,
+			&i.IsMerge,
+			&i.Verified,
+			&i.VerificationReason,
+			&i.Additions,
+			&i.Deletions,
+			&i.ChangedFiles,
+			&i.AuthorID,
+			&i.AuthorName,
+			&i.AuthorEmail,
+			&i.AuthorUsername,
+			&i.CommitterID,
+			&i.CommitterName,
+			&i.CommitterEmail,
+			&i.CommitterUsername,
 		); err != nil {
 			return nil, err
 		}
@@ -131,7 +278,7 @@ func (q *Queries) FindCommits(ctx context.Context, arg FindCommitsParams) ([]Fin
 }
 
 const getAuthor = `-- name: GetAuthor :one
-SELECT id, name, email, username FROM authors
+SELECT id, name, email, username, github_id FROM authors
 WHERE id = $1
 `
 
@@ -143,10 +290,112 @@ func (q *Queries) GetAuthor(ctx context.Context, id int64) (Author, error) {
 		&i.Name,
 		&i.Email,
 		&i.Username,
+		&i.GithubID,
 	)
 	return i, err
 }
 
+const getCommitActivity = `-- name: GetCommitActivity :many
+WITH filtered AS (
+    SELECT date_trunc($4::text, c.created_at AT TIME ZONE $5::text) AS bucket,
+        CASE WHEN $6::boolean THEN c.author_id END AS author_id
+    FROM commits c
+    JOIN repositories r ON c.repository_id = r.id
+    WHERE r.full_name = $1
+        AND ($2::timestamptz IS NULL OR c.created_at >= $2)
+        AND ($3::timestamptz IS NULL OR c.created_at <= $3)
+),
+series AS (
+    SELECT generate_series(
+        date_trunc($4::text, COALESCE($2::timestamptz AT TIME ZONE $5::text, (SELECT MIN(bucket) FROM filtered))),
+        date_trunc($4::text, COALESCE($3::timestamptz AT TIME ZONE $5::text, (SELECT MAX(bucket) FROM filtered))),
+        ('1 ' || $4::text)::interval
+    ) AS bucket
+),
+groups AS (
+    SELECT DISTINCT author_id FROM filtered
+    UNION
+    SELECT NULL::bigint WHERE NOT $6::boolean
+)
+SELECT (s.bucket AT TIME ZONE $5::text)::timestamptz AS bucket_start,
+    g.author_id, a.github_id AS author_github_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    COUNT(f.bucket) AS commit_count
+FROM series s
+CROSS JOIN groups g
+LEFT JOIN filtered f ON f.bucket = s.bucket AND f.author_id IS NOT DISTINCT FROM g.author_id
+LEFT JOIN authors a ON a.id = g.author_id
+GROUP BY s.bucket, g.author_id, a.github_id, a.name, a.email, a.username
+ORDER BY s.bucket, COALESCE(a.username, '') COLLATE "C", COALESCE(a.email, '') COLLATE "C", COALESCE(a.github_id, 0)
+`
+
+type GetCommitActivityParams struct {
+	FullName string
+	Column2  pgtype.Timestamptz
+	Column3  pgtype.Timestamptz
+	Column4  string
+	Column5  string
+	Column6  bool
+}
+
+type GetCommitActivityRow struct {
+	BucketStart    pgtype.Timestamptz
+	AuthorID       pgtype.Int8
+	AuthorGithubID pgtype.Int8
+	AuthorName     pgtype.Text
+	AuthorEmail    pgtype.Text
+	AuthorUsername pgtype.Text
+	CommitCount    int64
+}
+
+func (q *Queries) GetCommitActivity(ctx context.Context, arg GetCommitActivityParams) ([]GetCommitActivityRow, error) {
+	rows, err := q.db.Query(ctx, getCommitActivity,
+		arg.FullName,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+		arg.Column5,
+		arg.Column6,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCommitActivityRow
+	for rows.Next() {
+		var i GetCommitActivityRow
+		if err := rows.Scan(
+			&i.BucketStart,
+			&i.AuthorID,
+			&i.AuthorGithubID,
+			&i.AuthorName,
+			&i.AuthorEmail,
+			&i.AuthorUsername,
+			&i.CommitCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFirstCommitDate = `-- name: GetFirstCommitDate :one
+SELECT MIN(c.created_at)::timestamptz AS first_commit_date
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+WHERE r.full_name = $1
+`
+
+func (q *Queries) GetFirstCommitDate(ctx context.Context, fullName string) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getFirstCommitDate, fullName)
+	var first_commit_date pgtype.Timestamptz
+	err := row.Scan(&first_commit_date)
+	return first_commit_date, err
+}
+
 const getRepo = `-- name: GetRepo :one
 SELECT id, watchers, stargazers, full_name, created_at, updated_at, language, forks FROM repositories
 WHERE full_name = $1
@@ -169,7 +418,7 @@ func (q *Queries) GetRepo(ctx context.Context, fullName string) (Repository, err
 }
 
 const getTopCommitters = `-- name: GetTopCommitters :many
-SELECT a.id, a.name, a.email, a.username, COUNT(c.hash) as commit_count
+SELECT COALESCE(a.github_id, 0)::bigint AS id, a.name, a.email, a.username, COUNT(c.hash) as commit_count
 FROM authors a
 JOIN commits c ON a.id = c.author_id
 JOIN repositories r ON c.repository_id = r.id
@@ -177,7 +426,7 @@ WHERE r.full_name = $1
     AND ($2::timestamptz IS NULL OR c.created_at >= $2)
     AND ($3::timestamptz IS NULL OR c.created_at <= $3)
 GROUP BY a.id, a.name, a.email, a.username
-ORDER BY commit_count DESC
+ORDER BY commit_count DESC, COALESCE(a.username, '') COLLATE "C", COALESCE(a.email, '') COLLATE "C", COALESCE(a.github_id, 0)
 LIMIT $4 OFFSET $5
 `
 
@@ -229,106 +478,192 @@ func (q *Queries) GetTopCommitters(ctx context.Context, arg GetTopCommittersPara
 	return items, nil
 }
 
-const saveAuthor = `-- name: SaveAuthor :one
-INSERT INTO authors (id, name, email, username)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT (id) DO UPDATE SET
-    name = EXCLUDED.name,
-    email = EXCLUDED.email,
-    username = EXCLUDED.username
-RETURNING id, name, email, username
+const saveRepo = `-- name: SaveRepo :exec
+INSERT INTO repositories (id, watchers, stargazers, full_name, created_at, updated_at, language, forks)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (full_name) DO UPDATE SET
+    watchers = EXCLUDED.watchers,
+    stargazers = EXCLUDED.stargazers,
+    updated_at = EXCLUDED.updated_at,
+    language = EXCLUDED.language,
+    forks = EXCLUDED.forks
 `
 
-type SaveAuthorParams struct {
-	ID       int64
-	Name     string
-	Email    string
-	Username string
+type SaveRepoParams struct {
+	ID         int64
+	Watchers   int32
+	Stargazers int32
+	FullName   string
+	CreatedAt  pgtype.Timestamptz
+	UpdatedAt  pgtype.Timestamptz
+	Language   pgtype.Text
+	Forks      int32
 }
 
-func (q *Queries) SaveAuthor(ctx context.Context, arg SaveAuthorParams) (Author, error) {
-	row := q.db.QueryRow(ctx, saveAuthor,
+func (q *Queries) SaveRepo(ctx context.Context, arg SaveRepoParams) error {
+	_, err := q.db.Exec(ctx, saveRepo,
 		arg.ID,
-		arg.Name,
-		arg.Email,
-		arg.Username,
-	)
-	var i Author
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Email,
-		&i.Username,
+		arg.Watchers,
+		arg.Stargazers,
+		arg.FullName,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Language,
+		arg.Forks,
 	)
-	return i, err
+	return err
 }
 
-const saveCommit = `-- name: SaveCommit :exec
-INSERT INTO commits (hash, author_id, message, url, created_at, repository_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-ON CONFLICT (hash) DO NOTHING
+const searchCommits = `-- name: SearchCommits :many
+SELECT
+    c.hash, c.message, c.url, c.created_at, c.authored_at, c.parents, c.is_merge,
+    c.verified, c.verification_reason, c.additions, c.deletions, c.changed_files,
+    COALESCE(a.github_id, 0)::bigint AS author_id, a.name AS author_name, a.email AS author_email, a.username AS author_username,
+    cm.github_id AS committer_id, cm.name AS committer_name, cm.email AS committer_email, cm.username AS committer_username,
+    ts_rank(c.message_tsv, query) AS rank,
+    ts_headline('english',
+        replace(replace(replace(replace(replace(c.message, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'),
+        query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2') AS highlight
+FROM commits c
+JOIN repositories r ON c.repository_id = r.id
+JOIN authors a ON c.author_id = a.id
+LEFT JOIN authors cm ON c.committer_id = cm.id
+CROSS JOIN websearch_to_tsquery('english', $2) query
+WHERE r.full_name = $1
+    AND c.message_tsv @@ query
+    AND ($3::timestamptz IS NULL OR c.created_at >= $3)
+    AND ($4::timestamptz IS NULL OR c.created_at <= $4)
+    AND (NULLIF($5::text, '') IS NULL OR a.username = $5)
+ORDER BY rank DESC, c.created_at DESC, c.hash
+LIMIT $6 OFFSET $7
 `
 
-type SaveCommitParams struct {
-	Hash         string
-	AuthorID     int64
-	Message      string
-	Url          pgtype.Text
-	CreatedAt    pgtype.Timestamptz
-	RepositoryID int64
+type SearchCommitsParams struct {
+	FullName           string
+	WebsearchToTsquery string
+	Column3            pgtype.Timestamptz
+	Column4            pgtype.Timestamptz
+	Column5            string
+	Limit              int32
+	Offset             int32
 }
 
-func (q *Queries) SaveCommit(ctx context.Context, arg SaveCommitParams) error {
-	_, err := q.db.Exec(ctx, saveCommit,
-		arg.Hash,
-		arg.AuthorID,
-		arg.Message,
-		arg.Url,
-		arg.CreatedAt,
-		arg.RepositoryID,
+type SearchCommitsRow struct {
+	Hash               string
+	Message            string
+	Url                pgtype.Text
+	CreatedAt          pgtype.Timestamptz
+	AuthoredAt         pgtype.Timestamptz
+	Parents            []string
+	IsMerge            pgtype.Bool
+	Verified           pgtype.Bool
+	VerificationReason pgtype.Text
+	Additions          pgtype.Int4
+	Deletions          pgtype.Int4
+	ChangedFiles       pgtype.Int4
+	AuthorID           int64
+	AuthorName         string
+	AuthorEmail        string
+	AuthorUsername     string
+	CommitterID        pgtype.Int8
+	CommitterName      pgtype.Text
+	CommitterEmail     pgtype.Text
+	CommitterUsername  pgtype.Text
+	Rank               float32
+	Highlight          string
+}
+
+func (q *Queries) SearchCommits(ctx context.Context, arg SearchCommitsParams) ([]SearchCommitsRow, error) {
+	rows, err := q.db.Query(ctx, searchCommits,
+		arg.FullName,
+		arg.WebsearchToTsquery,
+		arg.Column3,
+		arg.Column4,
+		arg.Column5,
+		arg.Limit,
+		arg.Offset,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchCommitsRow
+	for rows.Next() {
+		var i SearchCommitsRow
+		if err := rows.Scan(
+			&i.Hash,
+			&i.Message,
+			&i.Url,
+			&i.CreatedAt,
+			&i.AuthoredAt,
+			&i.Parents,
+			&i.IsMerge,
+			&i.Verified,
+			&i.VerificationReason,
+			&i.Additions,
+			&i.Deletions,
+			&i.ChangedFiles,
+			&i.AuthorID,
+			&i.AuthorName,
+			&i.AuthorEmail,
+			&i.AuthorUsername,
+			&i.CommitterID,
+			&i.CommitterName,
+			&i.CommitterEmail,
+			&i.CommitterUsername,
+			&i.Rank,
+			&i.Highlight,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const saveManyCommits = `-- name: SaveManyCommits :many
-INSERT INTO commits (hash, author_id, message, url, created_at, repository_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-ON CONFLICT (hash) DO NOTHING
-RETURNING hash, author_id, message, url, created_at, repository_id
+const upsertLinkedAuthors = `-- name: UpsertLinkedAuthors :many
+INSERT INTO authors (github_id, name, email, username)
+SELECT github_id, name, email, username
+FROM unnest($1::bigint[], $2::text[], $3::text[], $4::text[]) AS a (github_id, name, email, username)
+ON CONFLICT (github_id) DO UPDATE SET
+    name = EXCLUDED.name,
+    email = EXCLUDED.email,
+    username = EXCLUDED.username
+RETURNING id, github_id
 `
 
-type SaveManyCommitsParams struct {
-	Hash         string
-	AuthorID     int64
-	Message      string
-	Url          pgtype.Text
-	CreatedAt    pgtype.Timestamptz
-	RepositoryID int64
+type UpsertLinkedAuthorsParams struct {
+	Column1 []int64
+	Column2 []string
+	Column3 []string
+	Column4 []string
 }
 
-func (q *Queries) SaveManyCommits(ctx context.Context, arg SaveManyCommitsParams) ([]Commit, error) {
-	rows, err := q.db.Query(ctx, saveManyCommits,
-		arg.Hash,
-		arg.AuthorID,
-		arg.Message,
-		arg.Url,
-		arg.CreatedAt,
-		arg.RepositoryID,
+type UpsertLinkedAuthorsRow struct {
+	ID       int64
+	GithubID pgtype.Int8
+}
+
+func (q *Queries) UpsertLinkedAuthors(ctx context.Context, arg UpsertLinkedAuthorsParams) ([]UpsertLinkedAuthorsRow, error) {
+	rows, err := q.db.Query(ctx, upsertLinkedAuthors,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Commit
+	var items []UpsertLinkedAuthorsRow
 	for rows.Next() {
-		var i Commit
+		var i UpsertLinkedAuthorsRow
 		if err := rows.Scan(
-			&i.Hash,
-			&i.AuthorID,
-			&i.Message,
-			&i.Url,
-			&i.CreatedAt,
-			&i.RepositoryID,
+			&i.ID,
+			&i.GithubID,
 		); err != nil {
 			return nil, err
 		}
@@ -340,38 +675,50 @@ func (q *Queries) SaveManyCommits(ctx context.Context, arg SaveManyCommitsParams
 	return items, nil
 }
 
-const saveRepo = `-- name: SaveRepo :exec
-INSERT INTO repositories (id, watchers, stargazers, full_name, created_at, updated_at, language, forks)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-ON CONFLICT (full_name) DO UPDATE SET
-    watchers = EXCLUDED.watchers,
-    stargazers = EXCLUDED.stargazers,
-    updated_at = EXCLUDED.updated_at,
-    language = EXCLUDED.language,
-    forks = EXCLUDED.forks
+const upsertUnlinkedAuthors = `-- name: UpsertUnlinkedAuthors :many
+INSERT INTO authors (name, email, username)
+SELECT name, email, username
+FROM unnest($1::text[], $2::text[], $3::text[]) AS a (name, email, username)
+ON CONFLICT (email) WHERE github_id IS NULL DO UPDATE SET
+    name = EXCLUDED.name,
+    username = EXCLUDED.username
+RETURNING id, email
 `
 
-type SaveRepoParams struct {
-	ID         int64
-	Watchers   int32
-	Stargazers int32
-	FullName   string
-	CreatedAt  pgtype.Timestamptz
-	UpdatedAt  pgtype.Timestamptz
-	Language   pgtype.Text
-	Forks      int32
+type UpsertUnlinkedAuthorsParams struct {
+	Column1 []string
+	Column2 []string
+	Column3 []string
 }
 
-func (q *Queries) SaveRepo(ctx context.Context, arg SaveRepoParams) error {
-	_, err := q.db.Exec(ctx, saveRepo,
-		arg.ID,
-		arg.Watchers,
-		arg.Stargazers,
-		arg.FullName,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Language,
-		arg.Forks,
+type UpsertUnlinkedAuthorsRow struct {
+	ID    int64
+	Email string
+}
+
+func (q *Queries) UpsertUnlinkedAuthors(ctx context.Context, arg UpsertUnlinkedAuthorsParams) ([]UpsertUnlinkedAuthorsRow, error) {
+	rows, err := q.db.Query(ctx, upsertUnlinkedAuthors,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertUnlinkedAuthorsRow
+	for rows.Next() {
+		var i UpsertUnlinkedAuthorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
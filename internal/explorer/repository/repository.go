@@ -2,36 +2,124 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 )
 
+// Errors shared by every backend. Implementations wrap them with details, so
+// callers should match them with errors.Is.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrInvalid  = errors.New("invalid")
+
+	// ErrDuplicateEvent is returned by writes handed an event that was
+	// already processed.
+	ErrDuplicateEvent = fmt.Errorf("event already processed: %w", ErrConflict)
+)
+
+// ProcessedEvent records that an event was handled. Writes record it
+// together with their changes, so a redelivered event is recognised instead
+// of being applied twice. Records are pruned after a retention window; an
+// event redelivered later than that is applied again.
+type ProcessedEvent struct {
+	ID   uuid.UUID
+	Kind events.EventKind
+}
+
+// IngestStats counts what a bulk commit write did. Duplicates are commits
+// that were already stored or repeated within the batch.
+type IngestStats struct {
+	Inserted   int
+	Duplicates int
+}
+
+// PaginatedResponse is a page of results. Offset listings fill Page, keyset
+// listings fill Next and Prev instead. TotalCount is only filled by keyset
+// listings when asked for with Pagination.WithTotal.
 type PaginatedResponse[T any] struct {
 	Data       []T
 	TotalCount int64
 	Page       int
 	PerPage    int
+	Next       string
+	Prev       string
 }
 
 type Pagination struct {
 	Page    int
 	PerPage int
+	// Cursor continues a keyset listing from an encoded Cursor. Keyset
+	// listings ignore Page.
+	Cursor    string
+	WithTotal bool
 }
 
 type IntentFilter struct {
 	IsActive bool
 }
 
+// OutboxFunc returns the outbox messages for an intent change, given the
+// intent before and after it.
+type OutboxFunc func(before, after *models.Intent) ([]OutboxMessage, error)
+
+// IntentRepository persists intents. Outbox messages passed to SaveIntent and
+// returned by the OutboxFunc of UpdateIntent are written atomically with the
+// intent change, so an intent is never stored without its event or the other
+// way round. UpdateIntent holds the intent from loading it until the write,
+// so concurrent updates see each other's changes. outbox may be nil.
 type IntentRepository interface {
-	SaveIntent(ctx context.Context, intent *models.Intent) error
+	SaveIntent(ctx context.Context, intent *models.Intent, outbox ...OutboxMessage) error
 	GetIntentById(ctx context.Context, id uuid.UUID) (*models.Intent, error)
 	GetIntentByRepo(ctx context.Context, repo string) (*models.Intent, error)
-	UpdateIntent(ctx context.Context, update *models.IntentUpdate) error
+	UpdateIntent(ctx context.Context, update *models.IntentUpdate, outbox OutboxFunc) error
 	GetIntents(ctx context.Context, filter IntentFilter) ([]*models.Intent, error)
 }
 
+// OutboxMessage is an event waiting to be relayed to the messaging system.
+type OutboxMessage struct {
+	ID        uuid.UUID
+	Queue     string
+	Kind      events.EventKind
+	Payload   []byte
+	CreatedAt time.Time
+	// Attempts counts the failed tries to publish the message.
+	Attempts int
+}
+
+// OutboxResult is what became of a claimed outbox message.
+type OutboxResult int
+
+const (
+	// OutboxPublished marks the message as sent.
+	OutboxPublished OutboxResult = iota
+	// OutboxRetry records a failed attempt and keeps the message pending. The
+	// rest of the batch is left for later so it does not overtake the message.
+	OutboxRetry
+	// OutboxAbandoned records the failure and sets the message aside for good,
+	// so the messages behind it can go ahead.
+	OutboxAbandoned
+)
+
+// OutboxHandler handles a claimed message. The error is recorded against the
+// message when it is not published.
+type OutboxHandler func(msg OutboxMessage) (OutboxResult, error)
+
+type OutboxRepository interface {
+	GetPendingMessages(ctx context.Context, limit int) ([]OutboxMessage, error)
+	// ClaimPending holds up to limit pending messages, oldest first, and hands
+	// them to handle in order. Messages held by another caller are skipped. The
+	// result of each message is stored before the claim is released; a claim
+	// may run out, after which the message is handed out again. It returns the
+	// number of messages claimed.
+	ClaimPending(ctx context.Context, limit int, handle OutboxHandler) (int, error)
+}
+
 type GroupAbleCol string
 
 const (
@@ -39,22 +127,83 @@ const (
 	CreatedAt     GroupAbleCol = "created_at"
 )
 
+// Interval is the width of a commit activity bucket.
+type Interval string
+
+const (
+	Hour  Interval = "hour"
+	Day   Interval = "day"
+	Week  Interval = "week"
+	Month Interval = "month"
+)
+
+func (i Interval) Valid() bool {
+	switch i {
+	case Hour, Day, Week, Month:
+		return true
+	}
+	return false
+}
+
+// ActivityFilter selects the commits counted by GetCommitActivity. Buckets
+// are always grouped on CreatedAt, truncated to Interval in Location, and
+// additionally on the author when GroupBy holds GroupByAuthor. Weeks start on
+// Monday. Without dates the series spans the first to the last commit.
+type ActivityFilter struct {
+	RepositoryName string
+	StartDate      *time.Time
+	EndDate        *time.Time
+	Interval       Interval
+	Location       *time.Location
+	GroupBy        []GroupAbleCol
+}
+
+func (f ActivityFilter) ByAuthor() bool {
+	for _, col := range f.GroupBy {
+		if col == GroupByAuthor {
+			return true
+		}
+	}
+	return false
+}
+
 type CommitsFilter struct {
 	RepositoryName string
 	StartDate      *time.Time
 	EndDate        *time.Time
+	// Author restricts the commits to a GitHub username when set.
+	Author string
 }
 
 type RemoteRepository interface {
 	SaveRepo(ctx context.Context, repo *models.Repository) error
 	GetRepo(ctx context.Context, name string) (*models.Repository, error)
+	// FindCommits lists commits newest first, using keyset pagination.
 	FindCommits(ctx context.Context, filter CommitsFilter, pagination Pagination) (PaginatedResponse[models.Commit], error)
+	// SearchCommits finds the commits whose message matches query, best
+	// matches first.
+	SearchCommits(ctx context.Context, query string, filter CommitsFilter, pagination Pagination) (PaginatedResponse[models.CommitMatch], error)
+	// GetTopCommitters ranks authors by commit count. Authors with as many
+	// commits are ordered by username, then email, then GitHub ID.
 	GetTopCommitters(ctx context.Context, repository string, startDate, endDate *time.Time, pagination Pagination) ([]models.AuthorStats, error)
-	SaveManyCommit(ctx context.Context, repoID int64, commit []models.Commit) error
+	// GetCommitActivity counts commits per bucket, filling buckets without
+	// commits with zero.
+	GetCommitActivity(ctx context.Context, filter ActivityFilter) ([]models.ActivityBucket, error)
+	// GetFirstCommitDate returns the date of the oldest commit of the
+	// repository, or nil when it has none.
+	GetFirstCommitDate(ctx context.Context, repository string) (*time.Time, error)
+	// SaveManyCommit stores the commits not stored yet. Processed events are
+	// recorded in the same transaction; when one of them already was,
+	// nothing is written and ErrDuplicateEvent is returned.
+	SaveManyCommit(ctx context.Context, repoID int64, commit []models.Commit, processed ...ProcessedEvent) (IngestStats, error)
 	SaveAuthor(ctx context.Context, author models.Author) error
+	// PruneProcessedEvents forgets the events processed before the given
+	// time and returns how many it forgot.
+	PruneProcessedEvents(ctx context.Context, before time.Time) (int64, error)
 }
 
 type RepositoryFactory interface {
 	IntentRepository() IntentRepository
 	RemoteRepository() RemoteRepository
+	OutboxRepository() OutboxRepository
 }
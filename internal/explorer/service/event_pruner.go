@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+)
+
+const eventPruneInterval = time.Hour
+
+// EventPruner forgets processed events once they are older than the
+// retention, which is how long a redelivered event is still recognised as a
+// duplicate. The retention has to outlast the broker's redeliveries and the
+// time a message may spend in the dead-letter queue before it is replayed.
+// Replaying older events is harmless for commits, which are deduplicated by
+// hash as well. A retention of zero keeps events forever.
+type EventPruner struct {
+	repo      repository.RemoteRepository
+	retention time.Duration
+}
+
+func NewEventPruner(repo repository.RemoteRepository, retention time.Duration) *EventPruner {
+	return &EventPruner{
+		repo:      repo,
+		retention: retention,
+	}
+}
+
+func (p *EventPruner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Prune(ctx); err != nil {
+			log.Printf("failed to prune processed events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune forgets the events processed more than the retention ago.
+func (p *EventPruner) Prune(ctx context.Context) error {
+	if p.retention <= 0 {
+		return nil
+	}
+	n, err := p.repo.PruneProcessedEvents(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("pruned %d processed events", n)
+	}
+	return nil
+}
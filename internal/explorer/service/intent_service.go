@@ -2,18 +2,22 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 )
 
 var (
-	ErrInvalidRepository = errors.New("invalid repo, only accept <owner>/<repo> format")
-	ErrExistingIntent    = errors.New("repo intent already booked")
+	ErrInvalidRepository = fmt.Errorf("%w repo, only accept <owner>/<repo> format", repository.ErrInvalid)
+	ErrExistingIntent    = fmt.Errorf("%w: repo intent already booked", repository.ErrConflict)
+	ErrIntentNotFound    = fmt.Errorf("intent %w", repository.ErrNotFound)
 )
 
 type IntentService interface {
@@ -24,30 +28,33 @@ type IntentService interface {
 }
 
 type intentService struct {
-	repo repository.IntentRepository
+	repo  repository.IntentRepository
+	relay *OutboxRelay
 }
 
-func NewIntentService(repo repository.IntentRepository) IntentService {
-	return &intentService{repo: repo}
+// NewIntentService creates an intent service. Intent events are written to the
+// outbox together with the intent and relay is woken to publish them.
+func NewIntentService(repo repository.IntentRepository, relay *OutboxRelay) IntentService {
+	return &intentService{repo: repo, relay: relay}
 }
 
 func (i *intentService) CreateIntent(ctx context.Context, repo string, since time.Time) (*models.Intent, error) {
-	if len(strings.Split(repo, "/")) < 2 {
-		return nil, ErrInvalidRepository
+	if !validRepository(repo) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRepository, repo)
 	}
 
 	if since.IsZero() {
 		since = time.Now()
 	}
 
-	oldIntent, err := i.repo.GetIntentByRepo(ctx, repo)
-	if err != nil {
+	_, err := i.repo.GetIntentByRepo(ctx, repo)
+	if err == nil {
+		return nil, ErrExistingIntent
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
 		return nil, err
 	}
 
-	if oldIntent != nil {
-		return nil, ErrExistingIntent
-	}
 	uid, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -61,15 +68,16 @@ func (i *intentService) CreateIntent(ctx context.Context, repo string, since tim
 		IsActive:   true,
 	}
 
-	err = i.repo.SaveIntent(ctx, intent)
+	msg, err := newIntentMessage(ctx, intent)
 	if err != nil {
 		return nil, err
 	}
 
-	// err = i.sendNewIntentEvent(ctx, intent)
-	// if err != nil {
-	// 	return nil, err
-	// }
+	err = i.repo.SaveIntent(ctx, intent, msg)
+	if err != nil {
+		return nil, err
+	}
+	i.relay.Notify()
 
 	return intent, nil
 }
@@ -85,41 +93,80 @@ func (i *intentService) GetIntents(ctx context.Context, isActive bool) ([]*model
 }
 
 func (i *intentService) UpdateIntent(ctx context.Context, update models.IntentUpdate) (*models.Intent, error) {
-	intent, err := i.repo.GetIntentById(ctx, update.ID)
+	var intent models.Intent
+	var notify bool
+	err := i.repo.UpdateIntent(ctx, &update, func(before, after *models.Intent) ([]repository.OutboxMessage, error) {
+		intent = *after
+		sinceMoved := !after.Since.Equal(before.Since)
+		reactivated := after.IsActive && !before.IsActive
+		paused := !after.IsActive && before.IsActive
+
+		var outbox []repository.OutboxMessage
+		switch {
+		case after.IsActive && (sinceMoved || reactivated):
+			msg, err := newIntentMessage(ctx, after)
+			if err != nil {
+				return nil, err
+			}
+			outbox = append(outbox, msg)
+		case paused:
+			msg, err := newOutboxMessage(ctx, events.REPO_INTENT_PAUSED, &events.RepoIntentPausedEvent{
+				Repository: after.Repository,
+			})
+			if err != nil {
+				return nil, err
+			}
+			outbox = append(outbox, msg)
+		}
+		notify = len(outbox) > 0
+
+		return outbox, nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrIntentNotFound, update.ID)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if notify {
+		i.relay.Notify()
+	}
 
-	err = i.repo.UpdateIntent(ctx, &update)
+	return &intent, nil
+}
+
+// validRepository reports whether repo is an <owner>/<repo> name, the only
+// form explorerd accepts.
+func validRepository(repo string) bool {
+	owner, name, ok := strings.Cut(repo, "/")
+	return ok && owner != "" && name != "" && !strings.Contains(name, "/")
+}
+
+func newIntentMessage(ctx context.Context, intent *models.Intent) (repository.OutboxMessage, error) {
+	return newOutboxMessage(ctx, events.NEW_REPO_INTENT, &events.NewRepoIntentEvent{
+		Since:      intent.Since,
+		Repository: intent.Repository,
+	})
+}
+
+// newOutboxMessage stores the whole envelope of the event, so that it keeps
+// its ID however often the relay has to publish it.
+func newOutboxMessage(ctx context.Context, kind events.EventKind, event interface{}) (repository.OutboxMessage, error) {
+	env, err := events.NewEnvelope(ctx, events.ProducerExplorer, kind, event)
 	if err != nil {
-		return nil, err
+		return repository.OutboxMessage{}, err
 	}
 
-	if !update.Since.IsZero() {
-		intent.Since = *update.Since
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return repository.OutboxMessage{}, fmt.Errorf("error marshaling %s event: %w", kind, err)
 	}
 
-	return intent, nil
+	return repository.OutboxMessage{
+		ID:        env.ID,
+		Queue:     events.IntentsQueue,
+		Kind:      kind,
+		Payload:   payload,
+		CreatedAt: env.ProducedAt,
+	}, nil
 }
-
-// func (i *intentService) sendNewIntentEvent(ctx context.Context, intent *models.Intent) error {
-// 	eventJSON, err := json.Marshal(&events.NewRepoIntentEvent{
-// 		Since:      intent.Since,
-// 		Repository: intent.Repository,
-// 	})
-
-// 	if err != nil {
-// 		return fmt.Errorf("error marshaling intent event: %w", err)
-// 	}
-
-// 	event := messaging.Event{
-// 		Subject: events.NEW_REPO_INTENT,
-// 		Data:    eventJSON,
-// 	}
-
-// 	err = i.nc.Publish(ctx, event)
-// 	if err != nil {
-// 		return fmt.Errorf("error publishing intent event: %w", err)
-// 	}
-// 	return nil
-// }
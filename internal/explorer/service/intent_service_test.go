@@ -2,12 +2,20 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
-
+	inmem "github.com/noelukwa/git-explorer/internal/explorer/repository/in-mem"
+	"github.com/noelukwa/git-explorer/internal/explorer/service"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockIntentRepository struct {
@@ -29,8 +37,8 @@ func (m *MockIntentRepository) FindIntents(ctx context.Context, pagination repos
 	return args.Get(0).(repository.PaginatedResponse[models.Intent]), args.Error(1)
 }
 
-func (m *MockIntentRepository) UpdateIntent(ctx context.Context, intent *models.IntentUpdate) error {
-	args := m.Called(ctx, intent)
+func (m *MockIntentRepository) UpdateIntent(ctx context.Context, intent *models.IntentUpdate, outbox repository.OutboxFunc) error {
+	args := m.Called(ctx, intent, outbox)
 	return args.Error(0)
 }
 
@@ -38,3 +46,162 @@ func (m *MockIntentRepository) DeleteIntent(ctx context.Context, id uuid.UUID) e
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
+
+type published struct {
+	queue string
+	kind  events.EventKind
+	data  []byte
+	env   *events.Envelope
+}
+
+type fakePublisher struct {
+	messages []published
+	// fail holds the events that cannot be published.
+	fail map[uuid.UUID]error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, queueName string, env *events.Envelope) error {
+	if err := p.fail[env.ID]; err != nil {
+		return err
+	}
+	p.messages = append(p.messages, published{queue: queueName, kind: env.Kind, data: env.Data, env: env})
+	return nil
+}
+
+func TestIntentEventsAreRelayed(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.NewRepositoryFactory()
+	publisher := &fakePublisher{}
+	relay := service.NewOutboxRelay(store.OutboxRepository(), publisher, time.Minute)
+	svc := service.NewIntentService(store.IntentRepository(), relay)
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	intent, err := svc.CreateIntent(events.WithTrace(ctx, "request-1"), "test/repo", since)
+	require.NoError(t, err)
+
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 1)
+	assert.Equal(t, events.IntentsQueue, publisher.messages[0].queue)
+	assert.Equal(t, events.NEW_REPO_INTENT, publisher.messages[0].kind)
+	assert.Equal(t, events.SchemaVersion, publisher.messages[0].env.Version)
+	assert.Equal(t, events.ProducerExplorer, publisher.messages[0].env.Producer)
+	assert.Equal(t, "request-1", publisher.messages[0].env.TraceID)
+
+	var event events.NewRepoIntentEvent
+	require.NoError(t, json.Unmarshal(publisher.messages[0].data, &event))
+	assert.Equal(t, "test/repo", event.Repository)
+	assert.True(t, since.Equal(event.Since))
+
+	// Relayed messages are not published twice.
+	require.NoError(t, relay.Flush(ctx))
+	assert.Len(t, publisher.messages, 1)
+
+	// Deactivating pauses monitoring, reactivating resumes it.
+	inactive, active := false, true
+	_, err = svc.UpdateIntent(ctx, models.IntentUpdate{ID: intent.ID, IsActive: &inactive})
+	require.NoError(t, err)
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 2)
+	assert.Equal(t, events.REPO_INTENT_PAUSED, publisher.messages[1].kind)
+
+	_, err = svc.UpdateIntent(ctx, models.IntentUpdate{ID: intent.ID, IsActive: &active})
+	require.NoError(t, err)
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 3)
+	assert.Equal(t, events.NEW_REPO_INTENT, publisher.messages[2].kind)
+
+	// Moving since emits, repeating the same since does not.
+	earlier := since.AddDate(-1, 0, 0)
+	_, err = svc.UpdateIntent(ctx, models.IntentUpdate{ID: intent.ID, IsActive: &active, Since: &earlier})
+	require.NoError(t, err)
+	_, err = svc.UpdateIntent(ctx, models.IntentUpdate{ID: intent.ID, IsActive: &active, Since: &earlier})
+	require.NoError(t, err)
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 4)
+
+	require.NoError(t, json.Unmarshal(publisher.messages[3].data, &event))
+	assert.True(t, earlier.Equal(event.Since))
+
+	// An update without is_active leaves the intent active.
+	earliest := earlier.AddDate(-1, 0, 0)
+	updated, err := svc.UpdateIntent(ctx, models.IntentUpdate{ID: intent.ID, Since: &earliest})
+	require.NoError(t, err)
+	assert.True(t, updated.IsActive)
+	assert.True(t, earliest.Equal(updated.Since))
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 5)
+	assert.Equal(t, events.NEW_REPO_INTENT, publisher.messages[4].kind)
+
+	_, err = svc.UpdateIntent(ctx, models.IntentUpdate{ID: uuid.New(), IsActive: &active})
+	assert.ErrorIs(t, err, service.ErrIntentNotFound)
+}
+
+func TestOutboxRelay_SetsAsidePoisonMessages(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.NewRepositoryFactory()
+	publisher := &fakePublisher{fail: make(map[uuid.UUID]error)}
+	relay := service.NewOutboxRelay(store.OutboxRepository(), publisher, time.Minute, service.WithMaxAttempts(2))
+	svc := service.NewIntentService(store.IntentRepository(), relay)
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := svc.CreateIntent(ctx, "test/first", since)
+	require.NoError(t, err)
+	_, err = svc.CreateIntent(ctx, "test/second", since)
+	require.NoError(t, err)
+
+	pending, err := store.OutboxRepository().GetPendingMessages(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	poison := pending[0].ID
+	publisher.fail[poison] = errors.New("rejected")
+
+	// A failing message holds back the ones behind it until it runs out of
+	// attempts.
+	assert.Error(t, relay.Flush(ctx))
+	assert.Empty(t, publisher.messages)
+
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 1)
+	assert.Equal(t, pending[1].ID, publisher.messages[0].env.ID)
+
+	pending, err = store.OutboxRepository().GetPendingMessages(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// A message that is not an envelope cannot be read and is set aside at
+	// once.
+	err = store.IntentRepository().SaveIntent(ctx, &models.Intent{ID: uuid.New(), Repository: "test/third", IsActive: true},
+		repository.OutboxMessage{
+			ID:        uuid.New(),
+			Queue:     events.IntentsQueue,
+			Kind:      events.NEW_REPO_INTENT,
+			Payload:   []byte(`{"repository":"test/third"}`),
+			CreatedAt: time.Now(),
+		})
+	require.NoError(t, err)
+	_, err = svc.CreateIntent(ctx, "test/fourth", since)
+	require.NoError(t, err)
+
+	require.NoError(t, relay.Flush(ctx))
+	require.Len(t, publisher.messages, 2)
+	assert.Equal(t, events.NEW_REPO_INTENT, publisher.messages[1].kind)
+}
+
+func TestCreateIntent_InvalidRepository(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.NewRepositoryFactory()
+	svc := service.NewIntentService(store.IntentRepository(), nil)
+
+	for _, repo := range []string{"", "repo", "a/b/c", "/x", "x/", "a//b", "/"} {
+		_, err := svc.CreateIntent(ctx, repo, time.Time{})
+		assert.ErrorIs(t, err, service.ErrInvalidRepository, repo)
+		assert.ErrorIs(t, err, repository.ErrInvalid, repo)
+	}
+
+	pending, err := store.OutboxRepository().GetPendingMessages(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, err = svc.CreateIntent(ctx, "owner/repo", time.Time{})
+	assert.NoError(t, err)
+}
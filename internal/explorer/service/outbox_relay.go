@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+)
+
+const (
+	outboxBatchSize = 100
+
+	// defaultOutboxMaxAttempts is how often a message may fail to publish
+	// before the relay gives up on it.
+	defaultOutboxMaxAttempts = 20
+
+	// outboxPublishTimeout bounds a single publish, retries included, well
+	// below the time the outbox keeps claimed messages from other relays.
+	outboxPublishTimeout = 30 * time.Second
+)
+
+// Publisher delivers events to the messaging system.
+type Publisher interface {
+	Publish(ctx context.Context, queueName string, env *events.Envelope) error
+}
+
+// OutboxRelay forwards messages written to the outbox to the publisher. It
+// polls on an interval and can be woken early with Notify.
+type OutboxRelay struct {
+	outbox      repository.OutboxRepository
+	publisher   Publisher
+	interval    time.Duration
+	maxAttempts int
+	wake        chan struct{}
+}
+
+// OutboxRelayOption configures an OutboxRelay.
+type OutboxRelayOption func(*OutboxRelay)
+
+// WithMaxAttempts sets how often a message may fail to publish before it is
+// set aside, so that it stops holding up the messages behind it.
+func WithMaxAttempts(n int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		if n > 0 {
+			r.maxAttempts = n
+		}
+	}
+}
+
+func NewOutboxRelay(outbox repository.OutboxRepository, publisher Publisher, interval time.Duration, opts ...OutboxRelayOption) *OutboxRelay {
+	r := &OutboxRelay{
+		outbox:      outbox,
+		publisher:   publisher,
+		interval:    interval,
+		maxAttempts: defaultOutboxMaxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Notify wakes the relay without blocking the caller.
+func (r *OutboxRelay) Notify() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Flush(ctx); err != nil {
+			log.Printf("failed to relay outbox messages: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// Flush publishes pending messages in the order they were written. It stops
+// at the first failure so later events never overtake earlier ones, unless
+// the failing message has used up its attempts or cannot be read at all; such
+// a message is logged and set aside.
+func (r *OutboxRelay) Flush(ctx context.Context) error {
+	for {
+		var failed error
+		claimed, err := r.outbox.ClaimPending(ctx, outboxBatchSize, func(msg repository.OutboxMessage) (repository.OutboxResult, error) {
+			env, err := events.Decode(msg.Payload)
+			if err != nil {
+				log.Printf("abandoning outbox message %s (%s), cannot read it: %v", msg.ID, msg.Kind, err)
+				return repository.OutboxAbandoned, err
+			}
+
+			publishCtx, cancel := context.WithTimeout(ctx, outboxPublishTimeout)
+			err = r.publisher.Publish(publishCtx, msg.Queue, env)
+			cancel()
+			if err == nil {
+				return repository.OutboxPublished, nil
+			}
+
+			if attempts := msg.Attempts + 1; attempts >= r.maxAttempts && ctx.Err() == nil {
+				log.Printf("abandoning outbox message %s (%s) after %d attempts: %v", msg.ID, msg.Kind, attempts, err)
+				return repository.OutboxAbandoned, err
+			}
+			failed = fmt.Errorf("failed to publish outbox message %s: %w", msg.ID, err)
+			return repository.OutboxRetry, err
+		})
+		if err != nil {
+			return err
+		}
+		if failed != nil {
+			return failed
+		}
+
+		if claimed < outboxBatchSize {
+			return nil
+		}
+	}
+}
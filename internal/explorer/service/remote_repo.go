@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/noelukwa/git-explorer/internal/events"
@@ -11,176 +13,253 @@ import (
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
 )
 
+var (
+	ErrMalformedEvent    = errors.New("malformed event payload")
+	ErrUnknownEvent      = errors.New("unknown event kind")
+	ErrUnknownRepository = fmt.Errorf("repository %w", repository.ErrNotFound)
+)
+
 type RemoteRepoService interface {
-	BatchSaveCommits(ctx context.Context, repoName string, commits []models.Commit) error
+	// BatchSaveCommits saves commits of a repository, recording the processed
+	// events in the same write.
+	BatchSaveCommits(ctx context.Context, repoName string, commits []models.Commit, processed ...repository.ProcessedEvent) (repository.IngestStats, error)
 	FindRepository(ctx context.Context, repoName string) (*models.Repository, error)
-	GetTopCommitters(ctx context.Context, repoName string, limit int) ([]models.AuthorStats, error)
-	GetCommits(ctx context.Context, repoName string, startDate, endDate time.Time, page, perPage int) (models.CommitPage, error)
-	Subcribe(ctx context.Context) error
-	Process(ctx context.Context, ek events.EventKind, b []byte)
+	GetTopCommitters(ctx context.Context, repoName string, startDate, endDate *time.Time, page, perPage int) ([]models.AuthorStats, error)
+	GetCommits(ctx context.Context, filter repository.CommitsFilter, cursor string, perPage int, withTotal bool) (models.CommitPage, error)
+	GetCommitActivity(ctx context.Context, filter repository.ActivityFilter) ([]models.ActivityBucket, error)
+	SearchCommits(ctx context.Context, query string, filter repository.CommitsFilter, page, perPage int) (models.CommitMatchPage, error)
+	Process(ctx context.Context, env *events.Envelope) error
+}
+
+// Clock tells the service the time, which ends open activity ranges.
+type Clock interface {
+	Now() time.Time
 }
 
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
 type remoteRepoService struct {
-	repo repository.RemoteRepository
+	repo  repository.RemoteRepository
+	clock Clock
 }
 
-func (s *remoteRepoService) BatchSaveCommits(ctx context.Context, repoName string, commits []models.Commit) error {
+func (s *remoteRepoService) BatchSaveCommits(ctx context.Context, repoName string, commits []models.Commit, processed ...repository.ProcessedEvent) (repository.IngestStats, error) {
 
-	repository, err := s.repo.GetRepo(ctx, repoName)
-	if err != nil || repository == nil {
-		return err
+	repo, err := s.findRepository(ctx, repoName)
+	if err != nil {
+		return repository.IngestStats{}, err
 	}
-	return s.repo.SaveManyCommit(ctx, repository.ID, commits)
+	return s.repo.SaveManyCommit(ctx, repo.ID, commits, processed...)
 }
 
 func (s *remoteRepoService) FindRepository(ctx context.Context, repoName string) (*models.Repository, error) {
-	return s.repo.GetRepo(ctx, repoName)
+	return s.findRepository(ctx, repoName)
 }
 
-func (s *remoteRepoService) GetTopCommitters(ctx context.Context, repoName string, limit int) ([]models.AuthorStats, error) {
-
-	_, err := s.repo.GetRepo(ctx, repoName)
-	if err != nil {
-		return nil, err
+// findRepository loads a repository, reporting a missing one as
+// ErrUnknownRepository.
+func (s *remoteRepoService) findRepository(ctx context.Context, repoName string) (*models.Repository, error) {
+	repo, err := s.repo.GetRepo(ctx, repoName)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRepository, repoName)
 	}
+	return repo, err
+}
+
+// GetTopCommitters ranks the authors of a repository by commit count, ties
+// broken by username. Counting happens in the repository, so the ranking
+// covers the whole history however long it is.
+func (s *remoteRepoService) GetTopCommitters(ctx context.Context, repoName string, startDate, endDate *time.Time, page, perPage int) ([]models.AuthorStats, error) {
 
-	filter := repository.CommitsFilter{
-		RepositoryName: repoName,
+	if _, err := s.findRepository(ctx, repoName); err != nil {
+		return nil, err
 	}
 
 	pagination := repository.Pagination{
-		Page:    1,
-		PerPage: 1000,
+		Page:    page,
+		PerPage: perPage,
 	}
 
-	commitsResp, err := s.repo.FindCommits(ctx, filter, pagination)
-	if err != nil {
-		return nil, err
-	}
+	return s.repo.GetTopCommitters(ctx, repoName, startDate, endDate, pagination)
+}
 
-	authorCommits := make(map[int64]int)
-	authorMap := make(map[int64]models.Author)
+func (s *remoteRepoService) GetCommits(ctx context.Context, filter repository.CommitsFilter, cursor string, perPage int, withTotal bool) (models.CommitPage, error) {
 
-	for _, commit := range commitsResp.Data {
-		authorCommits[commit.Author.ID]++
-		authorMap[commit.Author.ID] = commit.Author
+	if _, err := s.findRepository(ctx, filter.RepositoryName); err != nil {
+		return models.CommitPage{}, err
 	}
 
-	var topCommitters []models.AuthorStats
-	for authorID, count := range authorCommits {
-		topCommitters = append(topCommitters, models.AuthorStats{
-			Author:  authorMap[authorID],
-			Commits: int64(count),
-		})
+	pagination := repository.Pagination{
+		PerPage:   perPage,
+		Cursor:    cursor,
+		WithTotal: withTotal,
 	}
 
-	sort.Slice(topCommitters, func(i, j int) bool {
-		return topCommitters[i].Commits > topCommitters[j].Commits
-	})
-
-	if limit > len(topCommitters) {
-		limit = len(topCommitters)
+	repoResp, err := s.repo.FindCommits(ctx, filter, pagination)
+	if err != nil {
+		return models.CommitPage{}, err
 	}
 
-	return topCommitters[:limit], nil
+	page := models.CommitPage{
+		Commits: repoResp.Data,
+		PerPage: int32(perPage),
+		Next:    repoResp.Next,
+		Prev:    repoResp.Prev,
+	}
+	if withTotal {
+		page.TotalCount = &repoResp.TotalCount
+	}
+	return page, nil
 }
 
-func (s *remoteRepoService) GetCommits(ctx context.Context, repo string, startDate, endDate time.Time, page, perPage int) (models.CommitPage, error) {
-
-	_, err := s.repo.GetRepo(ctx, repo)
-	if err != nil {
-		return models.CommitPage{}, err
+func (s *remoteRepoService) SearchCommits(ctx context.Context, query string, filter repository.CommitsFilter, page, perPage int) (models.CommitMatchPage, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return models.CommitMatchPage{}, fmt.Errorf("%w: empty search query", repository.ErrInvalid)
 	}
 
-	filter := repository.CommitsFilter{
-		RepositoryName: repo,
-		StartDate:      &startDate,
-		EndDate:        &endDate,
+	if _, err := s.findRepository(ctx, filter.RepositoryName); err != nil {
+		return models.CommitMatchPage{}, err
 	}
+
 	pagination := repository.Pagination{
 		Page:    page,
 		PerPage: perPage,
 	}
 
-	repoResp, err := s.repo.FindCommits(ctx, filter, pagination)
+	resp, err := s.repo.SearchCommits(ctx, query, filter, pagination)
 	if err != nil {
-		return models.CommitPage{}, err
+		return models.CommitMatchPage{}, err
 	}
 
-	return models.CommitPage{
-		Commits:    repoResp.Data,
-		TotalCount: repoResp.TotalCount,
-		Page:       int32(repoResp.Page),
-		PerPage:    int32(repoResp.PerPage),
+	return models.CommitMatchPage{
+		Matches:    resp.Data,
+		TotalCount: resp.TotalCount,
+		Page:       int32(page),
+		PerPage:    int32(perPage),
 	}, nil
 }
 
-func NewRemoteRepoService(repo repository.RemoteRepository) RemoteRepoService {
-	return &remoteRepoService{
-		repo: repo,
+// maxActivityBuckets bounds the length of a zero-filled activity series.
+const maxActivityBuckets = 10000
+
+// bucketWidth is the shortest duration of each interval, used to bound the
+// number of buckets a date range can produce.
+var bucketWidth = map[repository.Interval]time.Duration{
+	repository.Hour:  time.Hour,
+	repository.Day:   24 * time.Hour,
+	repository.Week:  7 * 24 * time.Hour,
+	repository.Month: 28 * 24 * time.Hour,
+}
+
+func (s *remoteRepoService) GetCommitActivity(ctx context.Context, filter repository.ActivityFilter) ([]models.ActivityBucket, error) {
+	if !filter.Interval.Valid() {
+		return nil, fmt.Errorf("%w: unknown interval %q", repository.ErrInvalid, filter.Interval)
+	}
+	for _, col := range filter.GroupBy {
+		if col != repository.GroupByAuthor && col != repository.CreatedAt {
+			return nil, fmt.Errorf("%w: cannot group activity by %q", repository.ErrInvalid, col)
+		}
+	}
+	if filter.Location == nil {
+		filter.Location = time.UTC
+	}
+	if filter.StartDate != nil && filter.EndDate != nil && filter.EndDate.Before(*filter.StartDate) {
+		return nil, fmt.Errorf("%w: end date is before start date", repository.ErrInvalid)
+	}
+
+	if _, err := s.findRepository(ctx, filter.RepositoryName); err != nil {
+		return nil, err
+	}
+
+	// An open range runs from the first commit up to now, so it is bounded
+	// like any other.
+	if filter.EndDate == nil {
+		now := s.clock.Now()
+		filter.EndDate = &now
+	}
+	if filter.StartDate == nil {
+		first, err := s.repo.GetFirstCommitDate(ctx, filter.RepositoryName)
+		if err != nil {
+			return nil, err
+		}
+		if first == nil || first.After(*filter.EndDate) {
+			return []models.ActivityBucket{}, nil
+		}
+		filter.StartDate = first
 	}
+	if filter.EndDate.Sub(*filter.StartDate)/bucketWidth[filter.Interval] > maxActivityBuckets {
+		return nil, fmt.Errorf("%w: more than %d %s buckets requested", repository.ErrInvalid, maxActivityBuckets, filter.Interval)
+	}
+
+	return s.repo.GetCommitActivity(ctx, filter)
 }
 
-func (s *remoteRepoService) Subcribe(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// msgs, err := s.consumer.Fetch(1, jetstream.FetchMaxWait(5*time.Second))
-			// if err != nil {
-			// 	continue
-			// }
-
-			// for msg := range msgs.Messages() {
-			// 	// log.Printf("received intent: %s", msg.Subject())
-			// 	// if err := s.handleNewIntent(ctx, msg.Data()); err != nil {
-			// 	// 	log.Printf("Error handling intent: %v", err)
-			// 	// }
-			// 	// msg.Ack()
-			// }
+// RemoteRepoOption configures the service returned by NewRemoteRepoService.
+type RemoteRepoOption func(*remoteRepoService)
+
+// WithClock replaces the wall clock, so that tests know where open ranges
+// end.
+func WithClock(c Clock) RemoteRepoOption {
+	return func(s *remoteRepoService) {
+		if c != nil {
+			s.clock = c
 		}
 	}
 }
 
-func (s *remoteRepoService) Process(ctx context.Context, ek events.EventKind, b []byte) {
-	log.Printf("Received from gitexpress: EventKind=%s, Payload=%s", ek, string(b))
-	// Process the message here
+func NewRemoteRepoService(repo repository.RemoteRepository, opts ...RemoteRepoOption) RemoteRepoService {
+	s := &remoteRepoService{
+		repo:  repo,
+		clock: realClock{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// func (s *remoteRepoService) handleNewIntent(ctx context.Context, payload []byte) error {
-
-// 	if err := json.Unmarshal(payload, &msg); err != nil {
-// 		return fmt.Errorf("error unmarshalling payload: %w", err)
-// 	}
-
-// 	if msg.Subject == events.NEW_COMMITS_DATA {
-// 		var data events.NewCommitsDataEvent
-// 		if err := json.Unmarshal(msg.Data, &data); err != nil {
-// 			return fmt.Errorf("error unmarshalling payload: %w", err)
-// 		}
-
-// 		log.Println(data)
-// 		// repo, err := s.repo.GetRepo(ctx, data.Repository)
-// 		// if err != nil {
-// 		// 	return err
-// 		// }
-// 		// err = s.repo.SaveManyCommit(ctx, repo.ID, data.Commits)
-// 		// if err != nil {
-// 		// 	return err
-// 		// }
-
-// 	} else if msg.Subject == events.NEW_REPO_DATA {
-// 		var repo models.Repository
-// 		if err := json.Unmarshal(msg.Data, &repo); err != nil {
-// 			return fmt.Errorf("error unmarshalling payload: %w", err)
-// 		}
-// 		log.Println(repo)
-// 		// err := s.repo.SaveRepo(ctx, &repo)
-// 		// if err != nil {
-// 		// 	return err
-// 		// }
-// 	}
-
-// 	return nil
-// }
+// Process is the gitexpress consumer. It dispatches on the event kind; an
+// error leaves the message to be redelivered or dead-lettered by the broker.
+// Commits are saved together with the ID of their event, so a redelivered
+// batch is skipped.
+func (s *remoteRepoService) Process(ctx context.Context, env *events.Envelope) error {
+	switch env.Kind {
+	case events.NEW_REPO_DATA:
+		var data events.NewRepoDataEvent
+		if err := env.Unmarshal(&data); err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedEvent, err)
+		}
+		if data.Info == nil || data.Info.FullName == "" {
+			return fmt.Errorf("%w: missing repository info", ErrMalformedEvent)
+		}
+		return s.repo.SaveRepo(ctx, data.Info)
+
+	case events.NEW_COMMITS_DATA:
+		var data events.NewCommitsDataEvent
+		if err := env.Unmarshal(&data); err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedEvent, err)
+		}
+		if data.Repository == "" {
+			return fmt.Errorf("%w: missing repository name", ErrMalformedEvent)
+		}
+		if len(data.Commits) == 0 {
+			return nil
+		}
+		stats, err := s.BatchSaveCommits(ctx, data.Repository, data.Commits, repository.ProcessedEvent{ID: env.ID, Kind: env.Kind})
+		if errors.Is(err, repository.ErrDuplicateEvent) {
+			log.Printf("skipping %s event %s of %s, already processed", env.Kind, env.ID, data.Repository)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("saved commits of %s: %d new, %d duplicate", data.Repository, stats.Inserted, stats.Duplicates)
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, env.Kind)
+	}
+}
@@ -2,10 +2,18 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
+	"testing"
+	"time"
 
+	"github.com/noelukwa/git-explorer/internal/events"
 	"github.com/noelukwa/git-explorer/internal/explorer/models"
 	"github.com/noelukwa/git-explorer/internal/explorer/repository"
+	inmem "github.com/noelukwa/git-explorer/internal/explorer/repository/in-mem"
+	"github.com/noelukwa/git-explorer/internal/explorer/service"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockGitRemoteRepository struct {
@@ -46,3 +54,140 @@ func (m *MockGitRemoteRepository) GetCommit(ctx context.Context, hash string) (*
 	args := m.Called(ctx, hash)
 	return args.Get(0).(*models.Commit), args.Error(1)
 }
+
+func envelope(t *testing.T, kind events.EventKind, data interface{}) *events.Envelope {
+	t.Helper()
+	env, err := events.NewEnvelope(context.Background(), events.ProducerExplorerd, kind, data)
+	require.NoError(t, err)
+	return env
+}
+
+func TestProcess(t *testing.T) {
+	ctx := context.Background()
+	repo := inmem.NewRepositoryFactory().RemoteRepository()
+	svc := service.NewRemoteRepoService(repo)
+
+	repoEvent := envelope(t, events.NEW_REPO_DATA, events.NewRepoDataEvent{
+		Info: &models.Repository{ID: 1, FullName: "test/repo"},
+	})
+	require.NoError(t, svc.Process(ctx, repoEvent))
+
+	saved, err := repo.GetRepo(ctx, "test/repo")
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+
+	commitsEvent := envelope(t, events.NEW_COMMITS_DATA, events.NewCommitsDataEvent{
+		Repository: "test/repo",
+		Commits: []models.Commit{
+			{Hash: "123", Author: models.Author{Username: "author1"}, CreatedAt: time.Now()},
+			{Hash: "124", Author: models.Author{Username: "author2"}, CreatedAt: time.Now()},
+		},
+	})
+	require.NoError(t, svc.Process(ctx, commitsEvent))
+
+	commits, err := repo.FindCommits(ctx, repository.CommitsFilter{RepositoryName: "test/repo"}, repository.Pagination{Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	assert.Len(t, commits.Data, 2)
+
+	// A redelivered event is acknowledged without being applied again.
+	require.NoError(t, svc.Process(ctx, commitsEvent))
+	_, err = repo.SaveManyCommit(ctx, saved.ID, nil, repository.ProcessedEvent{ID: commitsEvent.ID, Kind: commitsEvent.Kind})
+	assert.ErrorIs(t, err, repository.ErrDuplicateEvent)
+}
+
+func TestEventPruner(t *testing.T) {
+	ctx := context.Background()
+	repo := inmem.NewRepositoryFactory().RemoteRepository()
+	svc := service.NewRemoteRepoService(repo)
+
+	require.NoError(t, svc.Process(ctx, envelope(t, events.NEW_REPO_DATA, events.NewRepoDataEvent{
+		Info: &models.Repository{ID: 1, FullName: "test/repo"},
+	})))
+	commitsEvent := envelope(t, events.NEW_COMMITS_DATA, events.NewCommitsDataEvent{
+		Repository: "test/repo",
+		Commits:    []models.Commit{{Hash: "123", CreatedAt: time.Now()}},
+	})
+	require.NoError(t, svc.Process(ctx, commitsEvent))
+	processed := repository.ProcessedEvent{ID: commitsEvent.ID, Kind: commitsEvent.Kind}
+
+	// Within the retention, and without one, the event is remembered.
+	require.NoError(t, service.NewEventPruner(repo, time.Hour).Prune(ctx))
+	require.NoError(t, service.NewEventPruner(repo, 0).Prune(ctx))
+	_, err := repo.SaveManyCommit(ctx, 1, nil, processed)
+	assert.ErrorIs(t, err, repository.ErrDuplicateEvent)
+
+	time.Sleep(time.Millisecond)
+	require.NoError(t, service.NewEventPruner(repo, time.Nanosecond).Prune(ctx))
+	_, err = repo.SaveManyCommit(ctx, 1, nil, processed)
+	assert.NoError(t, err)
+}
+
+func TestProcess_MalformedPayload(t *testing.T) {
+	ctx := context.Background()
+	repo := inmem.NewRepositoryFactory().RemoteRepository()
+	svc := service.NewRemoteRepoService(repo)
+
+	raw := func(kind events.EventKind, data string) *events.Envelope {
+		env := envelope(t, kind, nil)
+		env.Data = json.RawMessage(data)
+		return env
+	}
+
+	assert.ErrorIs(t, svc.Process(ctx, raw(events.NEW_REPO_DATA, `"not an object"`)), service.ErrMalformedEvent)
+	assert.ErrorIs(t, svc.Process(ctx, raw(events.NEW_REPO_DATA, `{"info":null}`)), service.ErrMalformedEvent)
+	assert.Error(t, svc.Process(ctx, raw(events.NEW_COMMITS_DATA, `{"repository":"unknown/repo","commits":[{"hash":"1"}]}`)))
+	assert.ErrorIs(t, svc.Process(ctx, raw(events.EventKind("SOMETHING_ELSE"), `{}`)), service.ErrUnknownEvent)
+}
+
+// fixedClock stops time, so open ranges end at a known instant.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestGetCommitActivity_OpenRange(t *testing.T) {
+	ctx := context.Background()
+	repo := inmem.NewRepositoryFactory().RemoteRepository()
+	now := time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+	svc := service.NewRemoteRepoService(repo, service.WithClock(fixedClock(now)))
+
+	require.NoError(t, repo.SaveRepo(ctx, &models.Repository{ID: 1, FullName: "test/repo"}))
+	require.NoError(t, repo.SaveRepo(ctx, &models.Repository{ID: 2, FullName: "empty/repo"}))
+
+	_, err := repo.SaveManyCommit(ctx, 1, []models.Commit{
+		{Hash: "1", Author: models.Author{Username: "author1"}, CreatedAt: now.Add(-3 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	// Without dates the series runs from the first commit up to now.
+	buckets, err := svc.GetCommitActivity(ctx, repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Hour})
+	require.NoError(t, err)
+	require.Len(t, buckets, 4)
+	assert.Equal(t, int64(1), buckets[0].Commits)
+	assert.Equal(t, time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC), buckets[0].Start.UTC())
+	assert.Equal(t, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), buckets[3].Start.UTC())
+
+	buckets, err = svc.GetCommitActivity(ctx, repository.ActivityFilter{RepositoryName: "empty/repo", Interval: repository.Hour})
+	require.NoError(t, err)
+	assert.Empty(t, buckets)
+
+	// Two years of history is too many hours for an open range.
+	_, err = repo.SaveManyCommit(ctx, 1, []models.Commit{
+		{Hash: "2", Author: models.Author{Username: "author1"}, CreatedAt: now.AddDate(-2, 0, 0)},
+	})
+	require.NoError(t, err)
+
+	_, err = svc.GetCommitActivity(ctx, repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Hour})
+	assert.ErrorIs(t, err, repository.ErrInvalid)
+
+	end := now
+	_, err = svc.GetCommitActivity(ctx, repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Hour, EndDate: &end})
+	assert.ErrorIs(t, err, repository.ErrInvalid)
+
+	start := now.Add(-24 * time.Hour)
+	buckets, err = svc.GetCommitActivity(ctx, repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Hour, StartDate: &start})
+	require.NoError(t, err)
+	assert.Len(t, buckets, 25)
+
+	_, err = svc.GetCommitActivity(ctx, repository.ActivityFilter{RepositoryName: "test/repo", Interval: repository.Day})
+	assert.NoError(t, err)
+}
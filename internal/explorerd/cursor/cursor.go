@@ -0,0 +1,87 @@
+package cursor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("cursor not found")
+
+// Window is a range of commit history, [Since, Until], still to be fetched.
+type Window struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// RepositoryIntent is explorerd's ingestion cursor for one repository.
+// History from Since up to LastFetched has been scheduled for download, and
+// everything outside of Pending has already been fetched. Paused cursors are
+// skipped by the monitoring loop. RefreshInfo asks the monitoring loop to
+// publish the repository's details again, as it does for a new intent.
+type RepositoryIntent struct {
+	Repo        string    `json:"repo"`
+	Since       time.Time `json:"since"`
+	LastFetched time.Time `json:"last_fetched"`
+	Pending     []Window  `json:"pending,omitempty"`
+	Paused      bool      `json:"paused,omitempty"`
+	RefreshInfo bool      `json:"refresh_info,omitempty"`
+}
+
+type Store interface {
+	Get(ctx context.Context, repo string) (*RepositoryIntent, error)
+	Put(ctx context.Context, intent *RepositoryIntent) error
+	List(ctx context.Context) ([]*RepositoryIntent, error)
+}
+
+func NewRepositoryIntent(repo string, since time.Time) *RepositoryIntent {
+	return &RepositoryIntent{
+		Repo:        repo,
+		Since:       since,
+		LastFetched: since,
+	}
+}
+
+// Request widens the cursor to start at since. Moving since back schedules a
+// backfill of only the missing range, moving it forward keeps what was
+// already fetched.
+func (ri *RepositoryIntent) Request(since time.Time) {
+	if since.IsZero() || !since.Before(ri.Since) {
+		return
+	}
+	ri.Pending = append(ri.Pending, Window{Since: since, Until: ri.Since})
+	ri.Since = since
+}
+
+// Advance schedules everything between LastFetched and now.
+func (ri *RepositoryIntent) Advance(now time.Time) {
+	if !now.After(ri.LastFetched) {
+		return
+	}
+	ri.Pending = append(ri.Pending, Window{Since: ri.LastFetched, Until: now})
+	ri.LastFetched = now
+}
+
+// Next returns the next window to fetch.
+func (ri *RepositoryIntent) Next() (Window, bool) {
+	if len(ri.Pending) == 0 {
+		return Window{}, false
+	}
+	return ri.Pending[0], true
+}
+
+// Done marks w as fetched.
+func (ri *RepositoryIntent) Done(w Window) {
+	for i, p := range ri.Pending {
+		if p.Since.Equal(w.Since) && p.Until.Equal(w.Until) {
+			ri.Pending = append(ri.Pending[:i], ri.Pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ri *RepositoryIntent) clone() *RepositoryIntent {
+	c := *ri
+	c.Pending = append([]Window(nil), ri.Pending...)
+	return &c
+}
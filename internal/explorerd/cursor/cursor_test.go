@@ -0,0 +1,89 @@
+package cursor_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/explorerd/cursor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	jan = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	apr = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func drain(intent *cursor.RepositoryIntent) []cursor.Window {
+	var windows []cursor.Window
+	for {
+		w, ok := intent.Next()
+		if !ok {
+			return windows
+		}
+		windows = append(windows, w)
+		intent.Done(w)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	intent := cursor.NewRepositoryIntent("test/repo", feb)
+	intent.Advance(mar)
+	assert.Equal(t, []cursor.Window{{Since: feb, Until: mar}}, drain(intent))
+
+	// Only the range after the last fetch is scheduled again.
+	intent.Advance(apr)
+	assert.Equal(t, []cursor.Window{{Since: mar, Until: apr}}, drain(intent))
+
+	intent.Advance(apr)
+	assert.Empty(t, drain(intent))
+}
+
+func TestRequest_Backfill(t *testing.T) {
+	intent := cursor.NewRepositoryIntent("test/repo", feb)
+	intent.Advance(apr)
+	drain(intent)
+
+	// Moving since forward keeps what was already fetched.
+	intent.Request(mar)
+	assert.Empty(t, drain(intent))
+	assert.Equal(t, feb, intent.Since)
+
+	// Moving since back only fetches the missing range.
+	intent.Request(jan)
+	assert.Equal(t, []cursor.Window{{Since: jan, Until: feb}}, drain(intent))
+	assert.Equal(t, jan, intent.Since)
+	assert.Equal(t, apr, intent.LastFetched)
+}
+
+func TestFileStore_Resume(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cursors.json")
+
+	store, err := cursor.NewFileStore(path)
+	require.NoError(t, err)
+
+	_, err = store.Get(ctx, "test/repo")
+	assert.ErrorIs(t, err, cursor.ErrNotFound)
+
+	intent := cursor.NewRepositoryIntent("test/repo", jan)
+	intent.Advance(mar)
+	require.NoError(t, store.Put(ctx, intent))
+
+	reopened, err := cursor.NewFileStore(path)
+	require.NoError(t, err)
+
+	restored, err := reopened.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	assert.True(t, mar.Equal(restored.LastFetched))
+	require.Len(t, restored.Pending, 1)
+	assert.True(t, jan.Equal(restored.Pending[0].Since))
+
+	all, err := reopened.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
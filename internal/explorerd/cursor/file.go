@@ -0,0 +1,102 @@
+package cursor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps cursors in memory and persists every change to a JSON file,
+// so explorerd resumes where it stopped after a restart.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cursor file: %w", err)
+	}
+
+	var intents []*RepositoryIntent
+	if err := json.Unmarshal(data, &intents); err != nil {
+		return nil, fmt.Errorf("failed to decode cursor file: %w", err)
+	}
+	for _, intent := range intents {
+		store.intents[intent.Repo] = intent
+	}
+
+	return store, nil
+}
+
+func (s *FileStore) Put(ctx context.Context, intent *RepositoryIntent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.intents[intent.Repo]
+	s.intents[intent.Repo] = intent.clone()
+
+	if err := s.flush(); err != nil {
+		if existed {
+			s.intents[intent.Repo] = previous
+		} else {
+			delete(s.intents, intent.Repo)
+		}
+		return err
+	}
+	return nil
+}
+
+// flush writes all cursors to a temporary file and renames it over the
+// previous one, so a crash never leaves a half-written file behind.
+func (s *FileStore) flush() error {
+	intents := make([]*RepositoryIntent, 0, len(s.intents))
+	for _, intent := range s.intents {
+		intents = append(intents, intent)
+	}
+
+	data, err := json.MarshalIndent(intents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cursors: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cursor directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create cursor file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cursor file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync cursor file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close cursor file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace cursor file: %w", err)
+	}
+	return nil
+}
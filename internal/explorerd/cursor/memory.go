@@ -0,0 +1,51 @@
+package cursor
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type MemoryStore struct {
+	intents map[string]*RepositoryIntent
+	mu      sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		intents: make(map[string]*RepositoryIntent),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, repo string) (*RepositoryIntent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	intent, exists := s.intents[repo]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return intent.clone(), nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, intent *RepositoryIntent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.intents[intent.Repo] = intent.clone()
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*RepositoryIntent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*RepositoryIntent, 0, len(s.intents))
+	for _, intent := range s.intents {
+		result = append(result, intent.clone())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Repo < result[j].Repo
+	})
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Start runs the monitoring loop. Every interval, or earlier when a new intent
+// wakes it, it walks all active intents and fetches the commits that landed
+// since their cursor, spreading the repositories over a pool of workers. A
+// first pass runs immediately, which also finishes any window left pending by
+// a previous run.
+func (svc *service) Start(ctx context.Context) error {
+	ticker := time.NewTicker(svc.interval)
+	defer ticker.Stop()
+
+	for {
+		svc.syncAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-svc.wake:
+		}
+	}
+}
+
+// notify wakes the monitoring loop without blocking the caller.
+func (svc *service) notify() {
+	select {
+	case svc.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (svc *service) syncAll(ctx context.Context) {
+	intents, err := svc.cursors.List(ctx)
+	if err != nil {
+		log.Printf("failed to list cursors: %v", err)
+		return
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < svc.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for repo := range jobs {
+				if err := svc.syncRepo(ctx, repo); err != nil {
+					log.Printf("failed to sync %s: %v", repo, err)
+				}
+			}
+		}()
+	}
+
+	active := 0
+dispatch:
+	for _, intent := range intents {
+		if intent.Paused {
+			continue
+		}
+		select {
+		case jobs <- intent.Repo:
+			active++
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	budget := svc.gc.Budget()
+	log.Printf("checked %d repositories, github budget %d/%d across %d tokens, resets at %s",
+		active, budget.Remaining, budget.Limit, budget.Tokens, budget.Reset.Format(time.RFC3339))
+}
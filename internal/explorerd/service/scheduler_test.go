@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorerd/cursor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart_SpreadsRepositoriesOverWorkers(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.delay = 20 * time.Millisecond
+	svc, cursors, published := newTestService(t, gh, time.Hour, 3)
+
+	var repos []string
+	for i := 0; i < 6; i++ {
+		repo := fmt.Sprintf("test/repo-%d", i)
+		repos = append(repos, repo)
+		gh.add(repo, fakeCommit{SHA: repo, Date: jan.AddDate(0, 0, 10)})
+		require.NoError(t, svc.Process(ctx, newIntent(t, repo, jan)))
+	}
+
+	// A paused repository is not handed to any worker.
+	paused := cursor.NewRepositoryIntent("test/paused", jan)
+	paused.Paused = true
+	require.NoError(t, cursors.Put(ctx, paused))
+	gh.add("test/paused", fakeCommit{SHA: "paused", Date: jan.AddDate(0, 0, 10)})
+
+	start(t, svc)
+
+	seen := make(map[string]bool)
+	for len(seen) < len(repos) {
+		env := receive(t, published)
+		if env.Kind != events.NEW_COMMITS_DATA {
+			continue
+		}
+		var data events.NewCommitsDataEvent
+		require.NoError(t, env.Unmarshal(&data))
+		seen[data.Repository] = true
+	}
+	for _, repo := range repos {
+		assert.True(t, seen[repo], repo)
+	}
+
+	checks, listings := gh.counts("test/paused")
+	assert.Zero(t, checks)
+	assert.Zero(t, listings)
+
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	assert.Greater(t, gh.maxInflight, 1, "repositories were synced one at a time")
+	assert.LessOrEqual(t, gh.maxInflight, 3, "more repositories synced at once than there are workers")
+}
+
+func TestStart_ChecksEveryInterval(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	svc, _, _ := newTestService(t, gh, 10*time.Millisecond, 2)
+
+	for _, repo := range []string{"test/a", "test/b"} {
+		gh.add(repo, fakeCommit{SHA: repo, Date: jan.AddDate(0, 0, 10)})
+		require.NoError(t, svc.Process(ctx, newIntent(t, repo, jan)))
+	}
+	start(t, svc)
+
+	require.Eventually(t, func() bool {
+		a, _ := gh.counts("test/a")
+		b, _ := gh.counts("test/b")
+		return a >= 3 && b >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// An intent for a repository being synced waits for the sync to finish, so
+// the sync cannot overwrite the cursor change with its own copy.
+func TestSync_SerialisesIntentsPerRepository(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.add("test/repo", fakeCommit{SHA: "a", Date: jan.AddDate(0, 0, 10)})
+	gh.add("test/other", fakeCommit{SHA: "b", Date: jan.AddDate(0, 0, 10)})
+	svc, cursors, _ := newTestService(t, gh, time.Hour, 2)
+
+	started, release := gh.hold("test/repo")
+
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+	start(t, svc)
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		release()
+		t.Fatal("sync did not start")
+	}
+
+	paused := make(chan error, 1)
+	go func() {
+		paused <- svc.Process(ctx, envelope(t, events.REPO_INTENT_PAUSED, events.RepoIntentPausedEvent{Repository: "test/repo"}))
+	}()
+
+	// Other repositories are not held up.
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/other", jan)))
+
+	select {
+	case <-paused:
+		release()
+		t.Fatal("pause did not wait for the running sync")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case err := <-paused:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("pause never finished")
+	}
+
+	intent, err := cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	assert.True(t, intent.Paused)
+	assert.Empty(t, intent.Pending)
+}
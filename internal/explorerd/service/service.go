@@ -1,224 +1,366 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/go-github/v63/github"
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorer/models"
+	"github.com/noelukwa/git-explorer/internal/explorerd/cursor"
 	octo "github.com/noelukwa/git-explorer/internal/pkg/github"
+	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
 )
 
-type RepositoryIntent struct {
-	Repo        string
-	Since       time.Time
-	Until       time.Time
-	LastFetched time.Time
-}
+var ErrUnknownEvent = errors.New("unknown event kind")
+
 type service struct {
-	interval time.Duration
-	gc       *octo.Client
+	interval    time.Duration
+	workers     int
+	gc          *octo.Client
+	mc          messaging.Broker
+	cursors     cursor.Store
+	locks       sync.Map
+	commitStats bool
+	wake        chan struct{}
+}
+
+type Option func(*service)
+
+// WithCommitStats fetches every commit on its own to learn its additions,
+// deletions and changed files. It costs one GitHub request per commit.
+func WithCommitStats() Option {
+	return func(svc *service) {
+		svc.commitStats = true
+	}
 }
 
-func NewService(interval time.Duration, gc *octo.Client) *service {
-	return &service{
+func NewService(interval time.Duration, workers int, gc *octo.Client, mc messaging.Broker, cursors cursor.Store, opts ...Option) *service {
+	if workers < 1 {
+		workers = 1
+	}
+	svc := &service{
 		interval: interval,
+		workers:  workers,
 		gc:       gc,
+		mc:       mc,
+		cursors:  cursors,
+		wake:     make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// Process is the gitintents consumer. It dispatches on the event kind; an
+// error leaves the message to be redelivered or dead-lettered by the broker.
+func (svc *service) Process(ctx context.Context, env *events.Envelope) error {
+	switch env.Kind {
+	case events.NEW_REPO_INTENT:
+		return svc.handleNewIntent(ctx, env)
+	case events.REPO_INTENT_PAUSED:
+		return svc.handlePausedIntent(ctx, env)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, env.Kind)
+	}
+}
+
+// publish sends data as an event of kind to explorer. Events published while
+// handling an intent join its correlation.
+func (svc *service) publish(ctx context.Context, kind events.EventKind, data interface{}) error {
+	env, err := events.NewEnvelope(ctx, events.ProducerExplorerd, kind, data)
+	if err != nil {
+		return err
+	}
+	return svc.mc.Publish(ctx, events.DataQueue, env)
+}
+
+// handleNewIntent only records the intent in the cursor and wakes the
+// monitoring loop, which does the fetching. A backfill can take far longer
+// than a broker waits for a message to be acknowledged.
+func (svc *service) handleNewIntent(ctx context.Context, env *events.Envelope) error {
+	var event events.NewRepoIntentEvent
+	if err := env.Unmarshal(&event); err != nil {
+		return fmt.Errorf("error unmarshalling payload: %w", err)
+	}
+
+	if _, _, err := splitRepo(event.Repository); err != nil {
+		return err
+	}
+
+	if err := svc.watch(ctx, event.Repository, event.Since); err != nil {
+		return err
+	}
+	svc.notify()
+	return nil
+}
+
+func (svc *service) handlePausedIntent(ctx context.Context, env *events.Envelope) error {
+	var event events.RepoIntentPausedEvent
+	if err := env.Unmarshal(&event); err != nil {
+		return fmt.Errorf("error unmarshalling payload: %w", err)
+	}
+
+	unlock := svc.lock(event.Repository)
+	defer unlock()
+
+	intent, err := svc.cursors.Get(ctx, event.Repository)
+	if errors.Is(err, cursor.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading cursor: %w", err)
+	}
+
+	intent.Paused = true
+	if err := svc.cursors.Put(ctx, intent); err != nil {
+		return fmt.Errorf("error storing cursor: %w", err)
+	}
+	return nil
+}
+
+// watch creates or widens the cursor of repo so it covers history from since,
+// and resumes monitoring it. The repository's details are published again on
+// the next sync.
+func (svc *service) watch(ctx context.Context, repo string, since time.Time) error {
+	unlock := svc.lock(repo)
+	defer unlock()
+
+	intent, err := svc.cursors.Get(ctx, repo)
+	switch {
+	case errors.Is(err, cursor.ErrNotFound):
+		intent = cursor.NewRepositoryIntent(repo, since)
+	case err != nil:
+		return fmt.Errorf("error loading cursor: %w", err)
+	default:
+		intent.Request(since)
+	}
+	intent.Paused = false
+	intent.RefreshInfo = true
+
+	if err := svc.cursors.Put(ctx, intent); err != nil {
+		return fmt.Errorf("error storing cursor: %w", err)
+	}
+	return nil
+}
+
+// syncRepo publishes the details of repo when asked to, schedules everything
+// up to now unless GitHub reports its default branch unchanged, and downloads
+// its pending windows. Paused repositories are left alone.
+func (svc *service) syncRepo(ctx context.Context, repo string) error {
+	unlock := svc.lock(repo)
+	defer unlock()
+
+	intent, err := svc.cursors.Get(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("error loading cursor: %w", err)
+	}
+	if intent.Paused {
+		return nil
+	}
+
+	owner, name, err := splitRepo(repo)
+	if err != nil {
+		return err
+	}
+
+	if intent.RefreshInfo {
+		if err := svc.fetchAndPublishRepoInfo(ctx, owner, name); err != nil {
+			return fmt.Errorf("error fetching and publishing repo info: %w", err)
+		}
+		intent.RefreshInfo = false
+		if err := svc.cursors.Put(ctx, intent); err != nil {
+			return fmt.Errorf("error storing cursor: %w", err)
+		}
+	}
+
+	changed, err := svc.gc.CommitsChanged(ctx, owner, name)
+	if err != nil {
+		return fmt.Errorf("error checking %s for new commits: %w", repo, err)
+	}
+
+	if changed {
+		intent.Advance(time.Now().UTC())
+		if err := svc.cursors.Put(ctx, intent); err != nil {
+			return fmt.Errorf("error storing cursor: %w", err)
+		}
+	}
+
+	return svc.fetchAndPublishCommits(ctx, intent)
+}
+
+// lock serialises work on a single repository between the intent consumer
+// and the monitoring workers.
+func (svc *service) lock(repo string) func() {
+	mu, _ := svc.locks.LoadOrStore(repo, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func (svc *service) fetchAndPublishRepoInfo(ctx context.Context, owner, repo string) error {
+	repoInfo, err := svc.gc.FetchRepo(ctx, owner, repo)
+	if err != nil {
+		return fmt.Errorf("error fetching repo info: %w", err)
+	}
+
+	event := &events.NewRepoDataEvent{
+		Info: &models.Repository{
+			Watchers:   int32(repoInfo.GetWatchersCount()),
+			StarGazers: int32(repoInfo.GetStargazersCount()),
+			FullName:   repoInfo.GetFullName(),
+			ID:         repoInfo.GetID(),
+			CreatedAt:  repoInfo.GetCreatedAt().Time,
+			UpdatedAt:  repoInfo.GetUpdatedAt().Time,
+			Language:   repoInfo.GetLanguage(),
+			Forks:      int32(repoInfo.GetForksCount()),
+		},
+	}
+
+	if err := svc.publish(ctx, events.NEW_REPO_DATA, event); err != nil {
+		return fmt.Errorf("error publishing repo info: %w", err)
+	}
+
+	return nil
+}
+
+// fetchAndPublishCommits downloads every pending window of the cursor. Each
+// page is published as soon as it arrives, but a window is only marked done
+// once all of its pages are: GitHub does not list commits strictly by date, so
+// no page tells how much of the window is left. An interrupted window is
+// fetched again from the start, which explorer ingests idempotently. The
+// caller must hold the repository lock.
+func (svc *service) fetchAndPublishCommits(ctx context.Context, intent *cursor.RepositoryIntent) error {
+	owner, repo, err := splitRepo(intent.Repo)
+	if err != nil {
+		return err
+	}
+
+	for {
+		window, ok := intent.Next()
+		if !ok {
+			return nil
+		}
+
+		err := svc.gc.FetchCommits(ctx, owner, repo, window.Since, window.Until, func(page []*github.RepositoryCommit) error {
+			if svc.commitStats {
+				if err := svc.fetchCommitStats(ctx, owner, repo, page); err != nil {
+					return err
+				}
+			}
+
+			convertedCommits := convertCommits(page)
+			if len(convertedCommits) > 0 {
+				event := &events.NewCommitsDataEvent{
+					Repository: intent.Repo,
+					Since:      window.Since,
+					Commits:    convertedCommits,
+				}
+
+				if err := svc.publish(ctx, events.NEW_COMMITS_DATA, event); err != nil {
+					return fmt.Errorf("error publishing commits: %w", err)
+				}
+				log.Printf("published %d commits for %s", len(convertedCommits), intent.Repo)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error fetching commits for %s: %w", intent.Repo, err)
+		}
+
+		intent.Done(window)
+		if err := svc.cursors.Put(ctx, intent); err != nil {
+			return fmt.Errorf("error storing cursor for %s: %w", intent.Repo, err)
+		}
+	}
+}
+
+// fetchCommitStats fills in the stats and changed files of a listed page,
+// which GitHub only returns for a single commit.
+func (svc *service) fetchCommitStats(ctx context.Context, owner, repo string, page []*github.RepositoryCommit) error {
+	for _, commit := range page {
+		detail, err := svc.gc.FetchCommit(ctx, owner, repo, commit.GetSHA())
+		if err != nil {
+			return fmt.Errorf("error fetching commit %s: %w", commit.GetSHA(), err)
+		}
+		commit.Stats = detail.Stats
+		commit.Files = detail.Files
 	}
+	return nil
 }
 
-// func (svc *service) Start(ctx context.Context) error {
-// 	ticker := time.NewTicker(svc.interval)
-// 	defer ticker.Stop()
-
-// 	for {
-// 		select {
-// 		case <-ctx.Done():
-// 			return ctx.Err()
-// 		case <-ticker.C:
-// 			log.Println("checking for repos")
-
-// 		}
-// 	}
-
-// }
-
-// func (svc *service) handleNewIntent(ctx context.Context, payload []byte) error {
-// 	var event events.NewRepoIntentEvent
-// 	if err := json.Unmarshal(payload, &event); err != nil {
-// 		return fmt.Errorf("error unmarshalling payload: %w", err)
-// 	}
-
-// 	intentKey := strings.ReplaceAll(event.Repository, "/", "_")
-// 	var intent RepositoryIntent
-
-// 	existingIntent, err := svc.kv.Get(ctx, intentKey)
-// 	if err == nil {
-// 		if err := json.Unmarshal(existingIntent.Value(), &intent); err != nil {
-// 			return fmt.Errorf("error unmarshalling existing intent: %w", err)
-// 		}
-// 	} else {
-// 		intent = RepositoryIntent{
-// 			Repo:        event.Repository,
-// 			Since:       event.Since,
-// 			LastFetched: event.Since,
-// 		}
-// 	}
-
-// 	if !event.Since.IsZero() {
-// 		if event.Since.Before(intent.Since) {
-// 			intent.Since = event.Since
-// 			intent.Until = intent.LastFetched
-// 		} else {
-// 			intent.Since = event.Since
-// 			intent.Until = time.Time{}
-// 		}
-// 		intent.LastFetched = intent.Since
-// 	}
-
-// 	intentJSON, err := json.Marshal(intent)
-// 	if err != nil {
-// 		return fmt.Errorf("error marshalling intent: %w", err)
-// 	}
-// 	_, err = svc.kv.Put(ctx, intentKey, intentJSON)
-// 	if err != nil {
-// 		return fmt.Errorf("error storing intent: %w", err)
-// 	}
-
-// 	if err := svc.fetchAndPublishRepoInfo(ctx, intent.Repo); err != nil {
-// 		return fmt.Errorf("error fetching and publishing repo info: %w", err)
-// 	}
-
-// 	return svc.fetchAndPublishCommits(ctx, intent)
-// }
-
-// func (svc *service) fetchAndPublishRepoInfo(ctx context.Context, fullRepo string) error {
-// 	parts := strings.Split(fullRepo, "/")
-// 	if len(parts) != 2 {
-// 		return fmt.Errorf("invalid repository format: %s", fullRepo)
-// 	}
-// 	owner, repo := parts[0], parts[1]
-
-// 	gc := octo.NewClient("")
-
-// 	repoInfo, err := gc.FetchRepo(owner, repo)
-// 	if err != nil {
-// 		return fmt.Errorf("error fetching repo info: %w", err)
-// 	}
-
-// 	event := &events.NewRepoDataEvent{
-
-// 		Info: &models.Repository{
-// 			Watchers:   int32(repoInfo.GetWatchersCount()),
-// 			StarGazers: int32(repoInfo.GetStargazersCount()),
-// 			FullName:   repoInfo.GetFullName(),
-// 			ID:         repoInfo.GetID(),
-// 			CreatedAt:  repoInfo.GetCreatedAt().Time,
-// 			UpdatedAt:  repoInfo.GetUpdatedAt().Time,
-// 			Language:   repoInfo.GetLanguage(),
-// 			Forks:      int32(repoInfo.GetForksCount()),
-// 		},
-// 	}
-
-// 	data, err := json.Marshal(event)
-// 	if err != nil {
-// 		return fmt.Errorf("error marshalling repo info: %w", err)
-// 	}
-
-// 	if err := svc.mc.Publish(ctx); err != nil {
-// 		return fmt.Errorf("error publishing repo info: %w", err)
-// 	}
-
-// 	return nil
-// }
-
-// func (svc *service) fetchAndPublishCommits(ctx context.Context, intent RepositoryIntent) error {
-// 	repo := strings.Split(intent.Repo, "/")
-// 	if len(repo) != 2 {
-// 		return fmt.Errorf("invalid repository format: %s", intent.Repo)
-// 	}
-
-// 	minTime := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-// 	maxTime := time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
-
-// 	since := intent.LastFetched
-// 	if since.Before(minTime) {
-// 		since = minTime
-// 	}
-
-// 	var until time.Time
-// 	if !intent.Until.IsZero() {
-// 		until = intent.Until
-// 		if until.After(maxTime) {
-// 			until = maxTime
-// 		}
-// 	}
-// 	gc := octo.NewClient("")
-
-// 	commits, err := gc.FetchCommits(repo[0], repo[1], since, until)
-// 	if err != nil {
-// 		return fmt.Errorf("error fetching commits for %s: %w", intent.Repo, err)
-// 	}
-
-// 	if len(commits) == 0 {
-// 		return nil
-// 	}
-
-// 	convertedCommits := convertCommits(commits)
-
-// 	if !intent.Until.IsZero() {
-// 		var filteredCommits []models.Commit
-// 		for _, commit := range convertedCommits {
-// 			if commit.CreatedAt.Before(intent.Until) || commit.CreatedAt.Equal(intent.Until) {
-// 				filteredCommits = append(filteredCommits, commit)
-// 			} else {
-// 				break
-// 			}
-// 		}
-// 		convertedCommits = filteredCommits
-// 	}
-
-// 	if len(convertedCommits) > 0 {
-// 		intent.LastFetched = convertedCommits[0].CreatedAt
-// 	}
-
-// 	event := events.NewCommitsDataEvent{
-// 		Repository: intent.Repo,
-// 		Since:      intent.LastFetched,
-// 		Commits:    convertedCommits,
-// 	}
-
-// 	data, err := json.Marshal(event)
-// 	if err != nil {
-// 		return fmt.Errorf("error marshalling commits: %w", err)
-// 	}
-
-// 	if err := svc.mc.Publish(ctx); err != nil {
-// 		return fmt.Errorf("error publishing commits: %w", err)
-// 	}
-
-// 	intentJSON, _ := json.Marshal(intent)
-// 	_, err = svc.kv.Put(ctx, "intent:"+intent.Repo, intentJSON)
-// 	if err != nil {
-// 		return fmt.Errorf("error storing updated intent for %s: %w", intent.Repo, err)
-// 	}
-
-// 	return nil
-// }
-
-// func convertCommits(githubCommits []*github.RepositoryCommit) []models.Commit {
-// 	var commits []models.Commit
-// 	for _, commit := range githubCommits {
-// 		if commit.Commit != nil && commit.Commit.Author != nil && commit.Commit.Committer != nil {
-// 			commits = append(commits, models.Commit{
-// 				Hash: commit.GetSHA(),
-// 				Author: models.Author{
-// 					Name:     commit.Commit.Author.GetName(),
-// 					Email:    commit.Commit.Author.GetEmail(),
-// 					Username: commit.Author.GetLogin(),
-// 					ID:       commit.Author.GetID(),
-// 				},
-// 				Message:   commit.Commit.GetMessage(),
-// 				CreatedAt: commit.Commit.Committer.GetDate().Time,
-// 			})
-// 		}
-// 	}
-// 	return commits
-// }
+func splitRepo(fullRepo string) (string, string, error) {
+	parts := strings.Split(fullRepo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid repository format: %s", fullRepo)
+	}
+	return parts[0], parts[1], nil
+}
+
+func convertCommits(githubCommits []*github.RepositoryCommit) []models.Commit {
+	var commits []models.Commit
+	for _, commit := range githubCommits {
+		if commit.Commit != nil && commit.Commit.Author != nil && commit.Commit.Committer != nil {
+			var parents []string
+			for _, parent := range commit.Parents {
+				parents = append(parents, parent.GetSHA())
+			}
+
+			var verification *models.Verification
+			if v := commit.Commit.Verification; v != nil {
+				verification = &models.Verification{Verified: v.GetVerified(), Reason: v.GetReason()}
+			}
+
+			var stats *models.CommitStats
+			if commit.Stats != nil {
+				stats = &models.CommitStats{
+					Additions:    commit.Stats.GetAdditions(),
+					Deletions:    commit.Stats.GetDeletions(),
+					ChangedFiles: len(commit.Files),
+				}
+			}
+
+			commits = append(commits, models.Commit{
+				Hash: commit.GetSHA(),
+				Author: models.Author{
+					Name:     commit.Commit.Author.GetName(),
+					Email:    commit.Commit.Author.GetEmail(),
+					Username: commit.Author.GetLogin(),
+					ID:       commit.Author.GetID(),
+				},
+				AuthoredAt: commit.Commit.Author.GetDate().Time,
+				Committer: models.Author{
+					Name:     commit.Commit.Committer.GetName(),
+					Email:    commit.Commit.Committer.GetEmail(),
+					Username: commit.Committer.GetLogin(),
+					ID:       commit.Committer.GetID(),
+				},
+				Message:      commit.Commit.GetMessage(),
+				Url:          parseURL(commit.GetHTMLURL()),
+				CreatedAt:    commit.Commit.Committer.GetDate().Time,
+				Parents:      parents,
+				Merge:        len(parents) > 1,
+				Verification: verification,
+				Stats:        stats,
+			})
+		}
+	}
+	return commits
+}
+
+func parseURL(rawURL string) *url.URL {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	return u
+}
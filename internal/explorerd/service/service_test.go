@@ -0,0 +1,517 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/explorerd/cursor"
+	"github.com/noelukwa/git-explorer/internal/explorerd/service"
+	octo "github.com/noelukwa/git-explorer/internal/pkg/github"
+	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	jan = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type fakeCommit struct {
+	SHA  string
+	Date time.Time
+}
+
+type hold struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+// fakeGitHub serves the endpoints explorerd uses from a list of commits per
+// repository. The newest commit is the ETag of the listing, so revalidating
+// it is answered with a 304 until a commit is added. Listings are split in
+// pages of pageSize commits when set, and page failPage fails.
+type fakeGitHub struct {
+	mu          sync.Mutex
+	commits     map[string][]fakeCommit
+	checks      map[string]int
+	listings    map[string]int
+	holds       map[string]*hold
+	delay       time.Duration
+	pageSize    int
+	failPage    int
+	inflight    int
+	maxInflight int
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{
+		commits:  make(map[string][]fakeCommit),
+		checks:   make(map[string]int),
+		listings: make(map[string]int),
+		holds:    make(map[string]*hold),
+	}
+}
+
+func (f *fakeGitHub) add(repo string, commits ...fakeCommit) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commits[repo] = append(f.commits[repo], commits...)
+	sort.Slice(f.commits[repo], func(i, j int) bool {
+		return f.commits[repo][i].Date.After(f.commits[repo][j].Date)
+	})
+}
+
+// hold makes commit listings of repo wait until release is called. started
+// is closed once the first one arrives.
+func (f *fakeGitHub) hold(repo string) (started <-chan struct{}, release func()) {
+	h := &hold{started: make(chan struct{}), release: make(chan struct{})}
+	f.mu.Lock()
+	f.holds[repo] = h
+	f.mu.Unlock()
+	return h.started, func() { close(h.release) }
+}
+
+func (f *fakeGitHub) counts(repo string) (checks, listings int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checks[repo], f.listings[repo]
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "commits") {
+		http.NotFound(w, r)
+		return
+	}
+	repo := parts[0] + "/" + parts[1]
+
+	f.mu.Lock()
+	f.inflight++
+	if f.inflight > f.maxInflight {
+		f.maxInflight = f.inflight
+	}
+	delay := f.delay
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inflight--
+		f.mu.Unlock()
+	}()
+	time.Sleep(delay)
+
+	switch {
+	case len(parts) == 2:
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "full_name": repo})
+	case r.URL.Query().Get("since") == "":
+		f.revalidate(w, r, repo)
+	default:
+		f.list(w, r, repo)
+	}
+}
+
+func (f *fakeGitHub) revalidate(w http.ResponseWriter, r *http.Request, repo string) {
+	f.mu.Lock()
+	f.checks[repo]++
+	commits := f.commits[repo]
+	f.mu.Unlock()
+
+	etag := `"empty"`
+	if len(commits) > 0 {
+		etag = `"` + commits[0].SHA + `"`
+		commits = commits[:1]
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	writeCommits(w, commits)
+}
+
+func (f *fakeGitHub) list(w http.ResponseWriter, r *http.Request, repo string) {
+	since, _ := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	until, _ := time.Parse(time.RFC3339, r.URL.Query().Get("until"))
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	f.mu.Lock()
+	f.listings[repo]++
+	commits := f.commits[repo]
+	h := f.holds[repo]
+	pageSize, failPage := f.pageSize, f.failPage
+	f.mu.Unlock()
+
+	if h != nil {
+		h.once.Do(func() { close(h.started) })
+		<-h.release
+	}
+	if page == failPage {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "Bad credentials"}`))
+		return
+	}
+
+	var matching []fakeCommit
+	for _, commit := range commits {
+		if !commit.Date.Before(since) && !commit.Date.After(until) {
+			matching = append(matching, commit)
+		}
+	}
+	if pageSize > 0 {
+		first := (page - 1) * pageSize
+		if first+pageSize < len(matching) {
+			next := *r.URL
+			query := next.Query()
+			query.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = query.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.RequestURI()))
+			matching = matching[first : first+pageSize]
+		} else if first < len(matching) {
+			matching = matching[first:]
+		} else {
+			matching = nil
+		}
+	}
+	writeCommits(w, matching)
+}
+
+func writeCommits(w http.ResponseWriter, commits []fakeCommit) {
+	out := make([]map[string]interface{}, 0, len(commits))
+	for _, commit := range commits {
+		person := map[string]interface{}{"name": "Alice", "email": "alice@example.com", "date": commit.Date}
+		out = append(out, map[string]interface{}{
+			"sha":    commit.SHA,
+			"commit": map[string]interface{}{"message": "commit " + commit.SHA, "author": person, "committer": person},
+			"author": map[string]interface{}{"login": "alice", "id": 1},
+		})
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+type testService interface {
+	Process(ctx context.Context, env *events.Envelope) error
+	Start(ctx context.Context) error
+}
+
+// newTestService wires a service to gh, an in-memory broker and cursor store.
+// Everything it publishes arrives on the returned channel.
+func newTestService(t *testing.T, gh *fakeGitHub, interval time.Duration, workers int) (testService, *cursor.MemoryStore, <-chan *events.Envelope) {
+	t.Helper()
+
+	srv := httptest.NewServer(gh)
+	t.Cleanup(srv.Close)
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	mc := messaging.NewInMemory()
+	require.NoError(t, mc.DeclareQueue(events.DataQueue))
+	published := make(chan *events.Envelope, 100)
+	require.NoError(t, mc.Subscribe(ctx, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		published <- env
+		return nil
+	}))
+
+	cursors := cursor.NewMemoryStore()
+	gc := octo.NewClient(nil, octo.WithBaseURL(base))
+	return service.NewService(interval, workers, gc, mc, cursors), cursors, published
+}
+
+// start runs the monitoring loop until the test ends.
+func start(t *testing.T, svc testService) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func envelope(t *testing.T, kind events.EventKind, data interface{}) *events.Envelope {
+	t.Helper()
+	env, err := events.NewEnvelope(context.Background(), events.ProducerExplorer, kind, data)
+	require.NoError(t, err)
+	return env
+}
+
+func newIntent(t *testing.T, repo string, since time.Time) *events.Envelope {
+	return envelope(t, events.NEW_REPO_INTENT, events.NewRepoIntentEvent{Repository: repo, Since: since})
+}
+
+func receive(t *testing.T, published <-chan *events.Envelope) *events.Envelope {
+	t.Helper()
+	select {
+	case env := <-published:
+		return env
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing was published")
+		return nil
+	}
+}
+
+func receiveCommits(t *testing.T, published <-chan *events.Envelope) events.NewCommitsDataEvent {
+	t.Helper()
+	env := receive(t, published)
+	require.Equal(t, events.NEW_COMMITS_DATA, env.Kind)
+	var data events.NewCommitsDataEvent
+	require.NoError(t, env.Unmarshal(&data))
+	return data
+}
+
+func hashes(data events.NewCommitsDataEvent) []string {
+	var out []string
+	for _, commit := range data.Commits {
+		out = append(out, commit.Hash)
+	}
+	return out
+}
+
+func assertQuiet(t *testing.T, published <-chan *events.Envelope, d time.Duration) {
+	t.Helper()
+	select {
+	case env := <-published:
+		t.Fatalf("unexpected %s event", env.Kind)
+	case <-time.After(d):
+	}
+}
+
+func TestNewIntent_PublishesInfoAndHistory(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.add("test/repo",
+		fakeCommit{SHA: "old", Date: jan.AddDate(0, 0, -10)},
+		fakeCommit{SHA: "a", Date: jan.AddDate(0, 0, 10)},
+		fakeCommit{SHA: "b", Date: feb.AddDate(0, 0, 10)},
+	)
+	svc, cursors, published := newTestService(t, gh, time.Hour, 1)
+
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+
+	// The consumer only records the intent, the monitoring loop fetches.
+	intent, err := cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	assert.True(t, jan.Equal(intent.Since))
+	assert.True(t, intent.RefreshInfo)
+	assert.False(t, intent.Paused)
+	_, listings := gh.counts("test/repo")
+	assert.Zero(t, listings)
+
+	start(t, svc)
+
+	env := receive(t, published)
+	require.Equal(t, events.NEW_REPO_DATA, env.Kind)
+	var info events.NewRepoDataEvent
+	require.NoError(t, env.Unmarshal(&info))
+	assert.Equal(t, "test/repo", info.Info.FullName)
+
+	data := receiveCommits(t, published)
+	assert.Equal(t, "test/repo", data.Repository)
+	assert.Equal(t, []string{"b", "a"}, hashes(data))
+
+	require.Eventually(t, func() bool {
+		intent, err := cursors.Get(ctx, "test/repo")
+		return err == nil && len(intent.Pending) == 0 && !intent.RefreshInfo
+	}, 2*time.Second, 10*time.Millisecond)
+	assertQuiet(t, published, 50*time.Millisecond)
+}
+
+func TestNewIntent_InvalidRepository(t *testing.T) {
+	svc, cursors, _ := newTestService(t, newFakeGitHub(), time.Hour, 1)
+
+	assert.Error(t, svc.Process(context.Background(), newIntent(t, "not-a-repo", jan)))
+	intents, err := cursors.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, intents)
+}
+
+func TestProcess_MalformedData(t *testing.T) {
+	svc, cursors, _ := newTestService(t, newFakeGitHub(), time.Hour, 1)
+
+	// Data that cannot be decoded is reported as such, so the broker
+	// dead-letters it instead of retrying.
+	for _, kind := range []events.EventKind{events.NEW_REPO_INTENT, events.REPO_INTENT_PAUSED} {
+		env := envelope(t, kind, nil)
+		env.Data = []byte(`"test/repo"`)
+		assert.ErrorIs(t, svc.Process(context.Background(), env), events.ErrMalformedData, kind)
+	}
+
+	intents, err := cursors.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, intents)
+}
+
+func TestSync_RevalidatesUnchangedRepository(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.add("test/repo", fakeCommit{SHA: "a", Date: jan.AddDate(0, 0, 10)})
+	svc, cursors, published := newTestService(t, gh, 10*time.Millisecond, 1)
+
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+	start(t, svc)
+	assert.Equal(t, events.NEW_REPO_DATA, receive(t, published).Kind)
+	assert.Equal(t, []string{"a"}, hashes(receiveCommits(t, published)))
+
+	// Every tick revalidates, and GitHub answering 304 means nothing to
+	// list.
+	require.Eventually(t, func() bool {
+		checks, _ := gh.counts("test/repo")
+		return checks >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+	_, listings := gh.counts("test/repo")
+	assert.Equal(t, 1, listings)
+	assertQuiet(t, published, 50*time.Millisecond)
+
+	// A new commit changes the ETag, and only what came after the last
+	// fetch is listed.
+	intent, err := cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	gh.add("test/repo", fakeCommit{SHA: "b", Date: intent.LastFetched.Truncate(time.Second)})
+
+	assert.Equal(t, []string{"b"}, hashes(receiveCommits(t, published)))
+}
+
+func TestNewIntent_WidensExistingCursor(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.add("test/repo",
+		fakeCommit{SHA: "a", Date: jan.AddDate(0, 0, 10)},
+		fakeCommit{SHA: "b", Date: feb.AddDate(0, 0, 10)},
+	)
+	svc, cursors, published := newTestService(t, gh, time.Hour, 1)
+
+	existing := cursor.NewRepositoryIntent("test/repo", feb)
+	existing.LastFetched = time.Now().UTC()
+	require.NoError(t, cursors.Put(ctx, existing))
+
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+	// A later start never narrows what is watched.
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", mar)))
+
+	intent, err := cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	assert.True(t, jan.Equal(intent.Since))
+	assert.Equal(t, []cursor.Window{{Since: jan, Until: feb}}, intent.Pending)
+	assert.True(t, intent.RefreshInfo)
+
+	// Only the missing range is fetched.
+	start(t, svc)
+	assert.Equal(t, events.NEW_REPO_DATA, receive(t, published).Kind)
+	data := receiveCommits(t, published)
+	assert.Equal(t, []string{"a"}, hashes(data))
+	assert.True(t, jan.Equal(data.Since))
+	assertQuiet(t, published, 50*time.Millisecond)
+}
+
+func TestPausedIntent_StopsMonitoring(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.add("test/repo", fakeCommit{SHA: "a", Date: jan.AddDate(0, 0, 10)})
+	svc, cursors, published := newTestService(t, gh, 10*time.Millisecond, 1)
+
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+	start(t, svc)
+	assert.Equal(t, events.NEW_REPO_DATA, receive(t, published).Kind)
+	assert.Equal(t, []string{"a"}, hashes(receiveCommits(t, published)))
+
+	paused := envelope(t, events.REPO_INTENT_PAUSED, events.RepoIntentPausedEvent{Repository: "test/repo"})
+	require.NoError(t, svc.Process(ctx, paused))
+	intent, err := cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	assert.True(t, intent.Paused)
+
+	// Paused repositories are neither revalidated nor listed, whatever lands
+	// on GitHub in the meantime.
+	gh.add("test/repo", fakeCommit{SHA: "b", Date: intent.LastFetched.Truncate(time.Second)})
+	checks, listings := gh.counts("test/repo")
+	assertQuiet(t, published, 100*time.Millisecond)
+	pausedChecks, pausedListings := gh.counts("test/repo")
+	assert.Equal(t, checks, pausedChecks)
+	assert.Equal(t, listings, pausedListings)
+
+	// A new intent resumes monitoring and catches up.
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+	intent, err = cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	assert.False(t, intent.Paused)
+	assert.Equal(t, events.NEW_REPO_DATA, receive(t, published).Kind)
+	assert.Equal(t, []string{"b"}, hashes(receiveCommits(t, published)))
+}
+
+func TestPausedIntent_UnknownRepository(t *testing.T) {
+	ctx := context.Background()
+	svc, cursors, _ := newTestService(t, newFakeGitHub(), time.Hour, 1)
+
+	paused := envelope(t, events.REPO_INTENT_PAUSED, events.RepoIntentPausedEvent{Repository: "test/repo"})
+	require.NoError(t, svc.Process(ctx, paused))
+
+	_, err := cursors.Get(ctx, "test/repo")
+	assert.ErrorIs(t, err, cursor.ErrNotFound)
+}
+
+// A window is only checkpointed once all of its pages are published, since a
+// page does not tell how much of the window is left.
+func TestSync_KeepsInterruptedWindowPending(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub()
+	gh.pageSize = 1
+	gh.failPage = 2
+	gh.add("test/repo",
+		fakeCommit{SHA: "a", Date: jan.AddDate(0, 0, 10)},
+		fakeCommit{SHA: "b", Date: jan.AddDate(0, 0, 20)},
+	)
+	svc, cursors, published := newTestService(t, gh, 10*time.Millisecond, 1)
+
+	require.NoError(t, svc.Process(ctx, newIntent(t, "test/repo", jan)))
+	start(t, svc)
+	assert.Equal(t, events.NEW_REPO_DATA, receive(t, published).Kind)
+	assert.Equal(t, []string{"b"}, hashes(receiveCommits(t, published)))
+
+	require.Eventually(t, func() bool {
+		_, listings := gh.counts("test/repo")
+		return listings >= 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	intent, err := cursors.Get(ctx, "test/repo")
+	require.NoError(t, err)
+	require.Len(t, intent.Pending, 1)
+	assert.True(t, jan.Equal(intent.Pending[0].Since))
+	assert.True(t, intent.LastFetched.Equal(intent.Pending[0].Until))
+
+	// Once GitHub recovers the whole window is fetched again.
+	gh.mu.Lock()
+	gh.failPage = 0
+	gh.mu.Unlock()
+	for {
+		data := receiveCommits(t, published)
+		if hashes(data)[0] == "a" {
+			break
+		}
+	}
+	require.Eventually(t, func() bool {
+		intent, err := cursors.Get(ctx, "test/repo")
+		return err == nil && len(intent.Pending) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,195 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const headerFromCache = "X-From-Cache"
+
+// CacheEntry is the last successful response to a conditional request.
+type CacheEntry struct {
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// Cache keeps validators and bodies of conditional requests, keyed by URL.
+type Cache interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry)
+}
+
+type MemoryCache struct {
+	entries map[string]CacheEntry
+	mu      sync.RWMutex
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: make(map[string]CacheEntry),
+	}
+}
+
+func (c *MemoryCache) Get(key string) (CacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *MemoryCache) Set(key string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entry
+}
+
+// DiskCache is a MemoryCache that writes through to one file per entry in a
+// directory, so validators survive restarts.
+type DiskCache struct {
+	*MemoryCache
+	dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{
+		MemoryCache: NewMemoryCache(),
+		dir:         dir,
+	}, nil
+}
+
+func (c *DiskCache) Get(key string) (CacheEntry, bool) {
+	if entry, ok := c.MemoryCache.Get(key); ok {
+		return entry, true
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return CacheEntry{}, false
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return CacheEntry{}, false
+	}
+	c.MemoryCache.Set(key, entry)
+	return entry, true
+}
+
+func (c *DiskCache) Set(key string, entry CacheEntry) {
+	c.MemoryCache.Set(key, entry)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.path(key), data, 0o644); err != nil {
+		log.Printf("failed to write github cache entry: %v", err)
+	}
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+type conditionalKey struct{}
+
+// conditional marks the requests made with ctx as worth revalidating. Only
+// those are cached, which keeps the cache to a handful of stable URLs per
+// repository instead of every commit window ever fetched.
+func conditional(ctx context.Context) context.Context {
+	return context.WithValue(ctx, conditionalKey{}, true)
+}
+
+// cacheTransport sends If-None-Match and If-Modified-Since for conditional
+// requests it has seen before. A 304 is answered from the cache and marked
+// with X-From-Cache, which go-github already understands.
+type cacheTransport struct {
+	base  http.RoundTripper
+	cache Cache
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Context().Value(conditionalKey{}) == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	entry, cached := t.cache.Get(key)
+	if cached {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		header := entry.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set(headerFromCache, "1")
+
+		return &http.Response{
+			Status:        http.StatusText(http.StatusOK),
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+			ContentLength: int64(len(entry.Body)),
+			Request:       req,
+		}, nil
+
+	case resp.StatusCode == http.StatusOK:
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag == "" && lastModified == "" {
+			return resp, nil
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		t.cache.Set(key, CacheEntry{
+			ETag:         etag,
+			LastModified: lastModified,
+			Header:       resp.Header.Clone(),
+			Body:         body,
+		})
+	}
+
+	return resp, nil
+}
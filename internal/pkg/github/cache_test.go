@@ -0,0 +1,90 @@
+package github_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	octo "github.com/noelukwa/git-explorer/internal/pkg/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// etagServer answers with etag until it is told the resource changed, and
+// with a 304 to requests that already carry it.
+func etagServer(body string, etag *atomic.Value, notModified *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := etag.Load().(string)
+		if r.Header.Get("If-None-Match") == current {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", current)
+		w.Write([]byte(body))
+	})
+}
+
+func TestFetchRepo_RevalidatesWithETag(t *testing.T) {
+	var etag atomic.Value
+	etag.Store(`"v1"`)
+	var notModified atomic.Int32
+	gc := newTestClient(t, etagServer(`{"id": 1, "full_name": "test/repo"}`, &etag, &notModified))
+
+	for i := 0; i < 3; i++ {
+		repo, err := gc.FetchRepo(context.Background(), "test", "repo")
+		require.NoError(t, err)
+		assert.Equal(t, "test/repo", repo.GetFullName())
+	}
+	assert.Equal(t, int32(2), notModified.Load())
+}
+
+func TestCommitsChanged(t *testing.T) {
+	var etag atomic.Value
+	etag.Store(`"a"`)
+	var notModified atomic.Int32
+	gc := newTestClient(t, etagServer(`[{"sha": "a"}]`, &etag, &notModified))
+
+	changed, err := gc.CommitsChanged(context.Background(), "test", "repo")
+	require.NoError(t, err)
+	assert.True(t, changed, "first poll has nothing to compare against")
+
+	changed, err = gc.CommitsChanged(context.Background(), "test", "repo")
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	etag.Store(`"b"`)
+	changed, err = gc.CommitsChanged(context.Background(), "test", "repo")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int32(1), notModified.Load())
+}
+
+func TestDiskCache_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	var etag atomic.Value
+	etag.Store(`"a"`)
+	var notModified atomic.Int32
+	srv := httptest.NewServer(etagServer(`[{"sha": "a"}]`, &etag, &notModified))
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+
+	// Each client stands for one run of explorerd sharing the cache directory.
+	poll := func() bool {
+		cache, err := octo.NewDiskCache(dir)
+		require.NoError(t, err)
+		gc := octo.NewClient(nil, octo.WithBaseURL(base), octo.WithCache(cache))
+		changed, err := gc.CommitsChanged(context.Background(), "test", "repo")
+		require.NoError(t, err)
+		return changed
+	}
+
+	assert.True(t, poll())
+	assert.False(t, poll())
+	assert.Equal(t, int32(1), notModified.Load())
+}
@@ -2,25 +2,98 @@ package github
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/google/go-github/v63/github"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
 )
 
 type Client struct {
-	client *github.Client
+	client    *github.Client
+	transport *tokenTransport
+	cache     *cacheTransport
+	retry     *retry.Policy
+	timeout   time.Duration
+	baseURL   *url.URL
 }
 
-func NewClient(token string) *Client {
-	hc := &http.Client{
-		Timeout: 10 * time.Second,
+type Option func(*Client)
+
+// WithRetry retries failed GitHub calls that are worth retrying with p.
+func WithRetry(p *retry.Policy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithCache keeps conditional request validators in cache instead of the
+// default in-memory cache.
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.cache.cache = cache
+	}
+}
+
+// WithTimeout bounds every HTTP request made to GitHub. Waiting for a rate
+// limit reset happens between retries and is not bounded by it. Zero means no
+// limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithBaseURL points the client at another API root, such as a GitHub
+// Enterprise server or a test stand-in. The URL must end with a slash.
+func WithBaseURL(u *url.URL) Option {
+	return func(c *Client) {
+		c.baseURL = u
+	}
+}
+
+// NewClient creates a GitHub client authenticated with tokens, which are used
+// round robin. Without tokens the client makes anonymous requests.
+func NewClient(tokens []string, opts ...Option) *Client {
+	transport := newTokenTransport(http.DefaultTransport, tokens)
+	cache := &cacheTransport{base: transport, cache: NewMemoryCache()}
+	c := &Client{
+		transport: transport,
+		cache:     cache,
+		timeout:   10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
-	return &Client{client: github.NewClient(hc)}
+
+	c.client = github.NewClient(&http.Client{
+		Timeout:   c.timeout,
+		Transport: cache,
+	})
+	if c.baseURL != nil {
+		c.client.BaseURL = c.baseURL
+	}
+	return c
 }
 
-func (c *Client) FetchCommits(owner, repo string, since, until time.Time) ([]*github.RepositoryCommit, error) {
-	ctx := context.Background()
+// Budget reports the rate limit left across all tokens, as of the last
+// response GitHub sent.
+func (c *Client) Budget() Budget {
+	return c.transport.budget()
+}
+
+// CommitPageFunc receives one page of commits. Returning an error stops the
+// listing and is passed back to the caller.
+type CommitPageFunc func(page []*github.RepositoryCommit) error
+
+// FetchCommits lists the commits of a repository between since and until,
+// newest first, handing each page to fn as soon as it arrives. Pages are
+// retried on their own, so when one fails for good every page before it has
+// already been delivered. The listing stops when ctx is cancelled.
+func (c *Client) FetchCommits(ctx context.Context, owner, repo string, since, until time.Time, fn CommitPageFunc) error {
 	opts := &github.CommitsListOptions{
 		ListOptions: github.ListOptions{
 			PerPage: 100,
@@ -28,23 +101,109 @@ func (c *Client) FetchCommits(owner, repo string, since, until time.Time) ([]*gi
 		Since: since,
 		Until: until,
 	}
-	var allCommits []*github.RepositoryCommit
 	for {
-		commits, resp, err := c.client.Repositories.ListCommits(ctx, owner, repo, opts)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var commits []*github.RepositoryCommit
+		var resp *github.Response
+		err := c.retry.Do(ctx, classifyError, func(ctx context.Context) error {
+			var err error
+			commits, resp, err = c.client.Repositories.ListCommits(ctx, owner, repo, opts)
+			return err
+		})
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if len(commits) > 0 {
+			if err := fn(commits); err != nil {
+				return err
+			}
 		}
-		allCommits = append(allCommits, commits...)
 		if resp.NextPage == 0 {
-			break
+			return nil
 		}
 		opts.Page = resp.NextPage
 	}
-	return allCommits, nil
 }
 
-func (c *Client) FetchRepo(owner, repo string) (*github.Repository, error) {
-	ctx := context.Background()
-	repository, _, err := c.client.Repositories.Get(ctx, owner, repo)
+// FetchCommit fetches a single commit with its details, which the listing
+// leaves out: the stats and the changed files.
+func (c *Client) FetchCommit(ctx context.Context, owner, repo, sha string) (*github.RepositoryCommit, error) {
+	var commit *github.RepositoryCommit
+	err := c.retry.Do(ctx, classifyError, func(ctx context.Context) error {
+		var err error
+		commit, _, err = c.client.Repositories.GetCommit(ctx, owner, repo, sha, nil)
+		return err
+	})
+	return commit, err
+}
+
+// CommitsChanged reports whether the default branch of a repository moved
+// since the last call. It revalidates the newest commit with GitHub, which
+// answers unchanged repositories with a 304 that costs no rate limit.
+func (c *Client) CommitsChanged(ctx context.Context, owner, repo string) (bool, error) {
+	ctx = conditional(ctx)
+	opts := &github.CommitsListOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 1,
+		},
+	}
+
+	var resp *github.Response
+	err := c.retry.Do(ctx, classifyError, func(ctx context.Context) error {
+		var err error
+		_, resp, err = c.client.Repositories.ListCommits(ctx, owner, repo, opts)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Header.Get(headerFromCache) == "", nil
+}
+
+// FetchRepo fetches repository metadata. Repeated calls are revalidated with
+// GitHub and served from the cache when nothing changed.
+func (c *Client) FetchRepo(ctx context.Context, owner, repo string) (*github.Repository, error) {
+	ctx = conditional(ctx)
+	var repository *github.Repository
+	err := c.retry.Do(ctx, classifyError, func(ctx context.Context) error {
+		var err error
+		repository, _, err = c.client.Repositories.Get(ctx, owner, repo)
+		return err
+	})
 	return repository, err
 }
+
+// classifyError retries server errors, timeouts and rate limits, and gives up
+// on everything else, such as a missing repository or a bad token.
+func classifyError(err error) (bool, time.Duration) {
+	var drained *RateLimitedError
+	if errors.As(err, &drained) {
+		return true, time.Until(drained.Reset)
+	}
+
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return true, time.Until(rateErr.Rate.Reset.Time)
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return true, abuseErr.GetRetryAfter()
+	}
+
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		status := respErr.Response.StatusCode
+		return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, 0
+	}
+
+	return false, 0
+}
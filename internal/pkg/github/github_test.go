@@ -0,0 +1,285 @@
+package github_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	octo "github.com/noelukwa/git-explorer/internal/pkg/github"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type instantClock struct{}
+
+func (instantClock) Now() time.Time { return time.Now() }
+
+func (instantClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return ch
+}
+
+func newTestClient(t *testing.T, handler http.Handler, opts ...octo.Option) *octo.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+
+	policy := retry.NewPolicy(3, time.Millisecond, time.Millisecond)
+	policy.Clock = instantClock{}
+
+	opts = append([]octo.Option{octo.WithBaseURL(base), octo.WithRetry(policy)}, opts...)
+	return octo.NewClient(nil, opts...)
+}
+
+func TestFetchRepo_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"id": 1, "full_name": "test/repo"}`))
+	}))
+
+	repo, err := gc.FetchRepo(context.Background(), "test", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, "test/repo", repo.GetFullName())
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestFetchRepo_NotFoundIsFatal(t *testing.T) {
+	var calls atomic.Int32
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	}))
+
+	_, err := gc.FetchRepo(context.Background(), "test", "missing")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestFetchCommits_KeepsFetchedPages(t *testing.T) {
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+		w.Header().Set("Link", `<http://`+r.Host+r.URL.Path+`?page=2>; rel="next"`)
+		w.Write([]byte(`[{"sha": "a"}, {"sha": "b"}]`))
+	}))
+
+	var pages [][]*github.RepositoryCommit
+	err := gc.FetchCommits(context.Background(), "test", "repo", time.Time{}, time.Time{}, func(page []*github.RepositoryCommit) error {
+		pages = append(pages, page)
+		return nil
+	})
+	assert.Error(t, err)
+	require.Len(t, pages, 1)
+	assert.Len(t, pages[0], 2)
+}
+
+func TestFetchCommits_StopsOnCancel(t *testing.T) {
+	var calls atomic.Int32
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		calls.Add(1)
+		w.Header().Set("Link", `<http://`+r.Host+r.URL.Path+`?page=`+strconv.Itoa(page+1)+`>; rel="next"`)
+		w.Write([]byte(`[{"sha": "a"}]`))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pages := 0
+	err := gc.FetchCommits(ctx, "test", "repo", time.Time{}, time.Time{}, func(page []*github.RepositoryCommit) error {
+		pages++
+		if pages == 2 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestFetchCommit(t *testing.T) {
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/test/repo/commits/abc", r.URL.Path)
+		w.Write([]byte(`{"sha": "abc", "stats": {"additions": 10, "deletions": 2, "total": 12}, "files": [{"filename": "a.go"}, {"filename": "b.go"}]}`))
+	}))
+
+	commit, err := gc.FetchCommit(context.Background(), "test", "repo", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, 10, commit.GetStats().GetAdditions())
+	assert.Len(t, commit.Files, 2)
+}
+
+func TestTokenRotation(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		mu.Lock()
+		seen = append(seen, auth)
+		mu.Unlock()
+
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		if auth == "Bearer token-a" {
+			// token-a is spent: the first call is the last one it may make.
+			w.Header().Set("X-RateLimit-Remaining", "0")
+		} else {
+			w.Header().Set("X-RateLimit-Remaining", "100")
+		}
+		w.Write([]byte(`{"id": 1, "full_name": "test/repo"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	gc := octo.NewClient([]string{"token-a", "token-b"}, octo.WithBaseURL(base))
+
+	for i := 0; i < 3; i++ {
+		_, err := gc.FetchRepo(context.Background(), "test", "repo")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"Bearer token-a", "Bearer token-b", "Bearer token-b"}, seen)
+
+	budget := gc.Budget()
+	assert.Equal(t, 2, budget.Tokens)
+	assert.Equal(t, 10000, budget.Limit)
+	assert.Equal(t, 100, budget.Remaining)
+}
+
+func TestTokenRotation_SwitchesOnRateLimit(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		if r.Header.Get("Authorization") == "Bearer token-a" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Write([]byte(`{"id": 1, "full_name": "test/repo"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	gc := octo.NewClient([]string{"token-a", "token-b"}, octo.WithBaseURL(base))
+
+	repo, err := gc.FetchRepo(context.Background(), "test", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, "test/repo", repo.GetFullName())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+type recordingClock struct {
+	mu    sync.Mutex
+	waits []time.Duration
+}
+
+func (c *recordingClock) Now() time.Time { return time.Now() }
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.waits = append(c.waits, d)
+	c.mu.Unlock()
+	return instantClock{}.After(d)
+}
+
+func TestFetchRepo_WaitsForResetOutsideTimeout(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	var repoCalls atomic.Int32
+	clock := &recordingClock{}
+	policy := retry.NewPolicy(2, time.Millisecond, time.Millisecond)
+	policy.Clock = clock
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		switch {
+		case r.URL.Path != "/repos/test/repo/commits":
+			repoCalls.Add(1)
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.Write([]byte(`{"id": 1, "full_name": "test/repo"}`))
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("X-RateLimit-Remaining", "1")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`[{"sha": "1"}]`))
+		}
+	}), octo.WithTimeout(50*time.Millisecond), octo.WithRetry(policy))
+
+	// The revalidation drains the token. It is answered from the cache, so
+	// go-github still believes there is budget left and sends the next
+	// request, which the transport refuses.
+	ctx := context.Background()
+	_, err := gc.CommitsChanged(ctx, "test", "repo")
+	require.NoError(t, err)
+	changed, err := gc.CommitsChanged(ctx, "test", "repo")
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, err = gc.FetchRepo(ctx, "test", "repo")
+	var drained *octo.RateLimitedError
+	require.ErrorAs(t, err, &drained)
+	assert.WithinDuration(t, reset, drained.Reset, 2*time.Second)
+	assert.Equal(t, int32(0), repoCalls.Load())
+
+	// Every retry waits for the reset, well past the request timeout.
+	require.Len(t, clock.waits, 2)
+	for _, wait := range clock.waits {
+		assert.Greater(t, wait, 50*time.Minute)
+	}
+}
+
+func TestFetchRepo_HonoursTimeout(t *testing.T) {
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), octo.WithTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := gc.FetchRepo(context.Background(), "test", "repo")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFetchRepo_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gc := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+
+	_, err := gc.FetchRepo(ctx, "test", "repo")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,196 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	headerRateLimit     = "X-RateLimit-Limit"
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset"
+)
+
+// Budget is the GitHub rate limit left across all configured tokens.
+type Budget struct {
+	Tokens    int
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+type tokenState struct {
+	token     string
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func (s *tokenState) available(now time.Time) bool {
+	return !s.known || s.remaining > 0 || !now.Before(s.reset)
+}
+
+// RateLimitedError is returned instead of sending a request when every token
+// ran dry. Reset is when the first of them is refilled.
+type RateLimitedError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("github rate limit exhausted on every token until %s", e.Reset.Format(time.RFC3339))
+}
+
+// tokenTransport authenticates requests with a pool of tokens used round
+// robin. It reads the rate limit headers of every response, skips tokens that
+// ran dry and, when all of them have, fails with a RateLimitedError instead of
+// spending requests on 403s. The wait for the reset is left to the retry
+// policy, since the request itself is bounded by the client timeout.
+type tokenTransport struct {
+	base   http.RoundTripper
+	tokens []*tokenState
+	next   int
+	mu     sync.Mutex
+}
+
+func newTokenTransport(base http.RoundTripper, tokens []string) *tokenTransport {
+	t := &tokenTransport{base: base}
+	for _, token := range tokens {
+		if token != "" {
+			t.tokens = append(t.tokens, &tokenState{token: token})
+		}
+	}
+	if len(t.tokens) == 0 {
+		// Unauthenticated requests still have a budget worth tracking.
+		t.tokens = append(t.tokens, &tokenState{})
+	}
+	return t
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for {
+		state, wait := t.pick()
+		if wait > 0 {
+			return nil, &RateLimitedError{Reset: time.Now().Add(wait)}
+		}
+
+		authReq := req.Clone(req.Context())
+		if state.token != "" {
+			authReq.Header.Set("Authorization", "Bearer "+state.token)
+		}
+
+		resp, err := t.base.RoundTrip(authReq)
+		if err != nil {
+			return nil, err
+		}
+		t.update(state, resp.Header)
+
+		exhausted := (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+			resp.Header.Get(headerRateRemaining) == "0"
+		if exhausted && req.Body == nil && t.hasBudget() {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			continue
+		}
+
+		t.rewrite(resp.Header)
+		return resp, nil
+	}
+}
+
+// pick returns the next token with budget left, or how long to wait for one.
+func (t *tokenTransport) pick() (*tokenState, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var earliest time.Time
+	for i := 0; i < len(t.tokens); i++ {
+		state := t.tokens[(t.next+i)%len(t.tokens)]
+		if state.available(now) {
+			t.next = (t.next + i + 1) % len(t.tokens)
+			return state, 0
+		}
+		if earliest.IsZero() || state.reset.Before(earliest) {
+			earliest = state.reset
+		}
+	}
+	return nil, earliest.Sub(now)
+}
+
+func (t *tokenTransport) update(state *tokenState, header http.Header) {
+	limit, errLimit := strconv.Atoi(header.Get(headerRateLimit))
+	remaining, errRemaining := strconv.Atoi(header.Get(headerRateRemaining))
+	reset, errReset := strconv.ParseInt(header.Get(headerRateReset), 10, 64)
+	if errLimit != nil || errRemaining != nil || errReset != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state.known = true
+	state.limit = limit
+	state.remaining = remaining
+	state.reset = time.Unix(reset, 0)
+}
+
+func (t *tokenTransport) hasBudget() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, state := range t.tokens {
+		if state.available(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite reports the budget of the whole pool to go-github, which would
+// otherwise refuse to send requests as soon as a single token runs dry.
+func (t *tokenTransport) rewrite(header http.Header) {
+	if len(t.tokens) < 2 || header.Get(headerRateRemaining) == "" {
+		return
+	}
+
+	budget := t.budget()
+	header.Set(headerRateLimit, strconv.Itoa(budget.Limit))
+	header.Set(headerRateRemaining, strconv.Itoa(budget.Remaining))
+	header.Set(headerRateReset, strconv.FormatInt(budget.Reset.Unix(), 10))
+}
+
+// budget sums the pool. Tokens that have not been used yet are assumed to
+// have a full budget, sized like the tokens GitHub has told us about.
+func (t *tokenTransport) budget() Budget {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	budget := Budget{Tokens: len(t.tokens)}
+	unknown, fullLimit := 0, 0
+	for _, state := range t.tokens {
+		if !state.known {
+			unknown++
+			continue
+		}
+		fullLimit = max(fullLimit, state.limit)
+		budget.Limit += state.limit
+		if now.Before(state.reset) {
+			budget.Remaining += state.remaining
+		} else {
+			budget.Remaining += state.limit
+		}
+		if budget.Reset.IsZero() || state.reset.Before(budget.Reset) {
+			budget.Reset = state.reset
+		}
+	}
+	budget.Limit += unknown * fullLimit
+	budget.Remaining += unknown * fullLimit
+	return budget
+}
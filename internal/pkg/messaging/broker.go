@@ -0,0 +1,182 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
+)
+
+// Providers accepted by New.
+const (
+	ProviderNATS     = "nats"
+	ProviderRabbitMQ = "rabbitmq"
+	ProviderInMemory = "inmem"
+)
+
+// Headers carried by every message, next to the envelope in its body. The
+// delivery count and error are only set on redelivered and dead-lettered
+// messages.
+const (
+	headerEventKind  = "event_kind"
+	headerDeliveries = "x-deliveries"
+	headerError      = "x-error"
+	headerFailedAt   = "x-failed-at"
+)
+
+var (
+	// ErrDisconnected is returned while the connection to the broker is
+	// down and being recovered.
+	ErrDisconnected = errors.New("broker disconnected")
+	// ErrClosed is returned once the broker is closed.
+	ErrClosed = errors.New("broker closed")
+)
+
+// DefaultMaxDeliveries is how often a message is handed to a failing handler
+// before it is dead-lettered, unless set with WithMaxDeliveries.
+const DefaultMaxDeliveries = 5
+
+// Handler consumes the event of one message of a queue. The message is
+// acknowledged when it returns nil and redelivered otherwise, until it is
+// dead-lettered. Messages without a valid envelope, including those of an
+// unsupported schema version, are dead-lettered without reaching it. ctx
+// carries env as the cause of the events the handler produces.
+type Handler func(ctx context.Context, env *events.Envelope) error
+
+// DeadLetter is a message that failed every delivery, or could not be handed
+// to a handler at all, along with the last error it met.
+type DeadLetter struct {
+	Queue      string           `json:"queue"`
+	Event      events.EventKind `json:"event_kind"`
+	Payload    json.RawMessage  `json:"payload"`
+	Error      string           `json:"error"`
+	Deliveries int              `json:"deliveries"`
+	FailedAt   time.Time        `json:"failed_at"`
+}
+
+// DeadLetterQueue names the queue holding the dead letters of queue.
+func DeadLetterQueue(queue string) string {
+	return queue + "-dlq"
+}
+
+// Broker moves events between explorer and explorerd over durable queues.
+type Broker interface {
+	// DeclareQueue creates the queue and its dead-letter queue if they do
+	// not exist yet. It is safe to call from every process using the queue.
+	DeclareQueue(name string) error
+	// Publish sends env to the queue.
+	Publish(ctx context.Context, queueName string, env *events.Envelope) error
+	// Subscribe hands every message of the queue to handler until ctx is
+	// cancelled. It returns once the consumer is registered.
+	Subscribe(ctx context.Context, queueName string, handler Handler) error
+	// DeadLetters lists up to limit dead letters of the queue, oldest
+	// first, leaving them in place.
+	DeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error)
+	// Replay moves up to limit dead letters back onto the queue, oldest
+	// first, and reports how many were moved.
+	Replay(ctx context.Context, queueName string, limit int) (int, error)
+	// Health returns nil while the broker is usable, ErrDisconnected while
+	// its connection is being recovered and ErrClosed once it is closed.
+	Health() error
+	Close()
+}
+
+type options struct {
+	retry         *retry.Policy
+	maxDeliveries int
+}
+
+func newOptions(opts []Option) options {
+	o := options{maxDeliveries: DefaultMaxDeliveries}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+type Option func(*options)
+
+// WithRetry retries failed publishes that are worth retrying with p.
+func WithRetry(p *retry.Policy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithMaxDeliveries bounds how often a message is handed to a failing
+// handler before it is dead-lettered.
+func WithMaxDeliveries(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxDeliveries = n
+		}
+	}
+}
+
+// schemes lists the URL schemes each networked provider dials.
+var schemes = map[string][]string{
+	ProviderNATS:     {"nats", "tls", "ws", "wss"},
+	ProviderRabbitMQ: {"amqp", "amqps"},
+}
+
+// New connects to the broker of the given provider at url. The in-memory
+// provider takes no url. A url meant for another provider is rejected before
+// anything is dialled.
+func New(provider, url string, opts ...Option) (Broker, error) {
+	if err := checkScheme(provider, url); err != nil {
+		return nil, err
+	}
+
+	switch provider {
+	case ProviderNATS:
+		return NewJetStream(url, opts...)
+	case ProviderRabbitMQ:
+		return NewRabbitMQ(url, opts...)
+	case ProviderInMemory:
+		return NewInMemory(opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown messaging provider %q", provider)
+	}
+}
+
+// checkScheme fails when rawURL has a scheme that provider does not dial.
+// NATS also takes a comma separated list of servers, of which the first is
+// checked.
+func checkScheme(provider, rawURL string) error {
+	accepted, ok := schemes[provider]
+	if !ok {
+		return nil
+	}
+
+	first, _, _ := strings.Cut(rawURL, ",")
+	if !strings.Contains(first, "://") {
+		return nil
+	}
+	u, err := url.Parse(first)
+	if err != nil {
+		return fmt.Errorf("invalid messaging url: %w", err)
+	}
+	if !slices.Contains(accepted, u.Scheme) {
+		return fmt.Errorf("messaging provider %q cannot dial %s:// urls, check the messaging provider setting", provider, u.Scheme)
+	}
+	return nil
+}
+
+// handle opens the envelope in body and hands it to handler. A body that
+// cannot be opened, or whose data the handler cannot decode, fails with a
+// poison error, which is never retried.
+func handle(ctx context.Context, body []byte, handler Handler) (poison bool, err error) {
+	env, err := events.Decode(body)
+	if err != nil {
+		return true, err
+	}
+	err = handler(events.WithCause(ctx, env), env)
+	return errors.Is(err, events.ErrMalformedData), err
+}
@@ -0,0 +1,238 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+)
+
+// InMemory is a Broker within a single process, for running explorer and
+// explorerd together without an external broker. Messages are kept until a
+// subscriber takes them and are lost when the process exits.
+type InMemory struct {
+	mu            sync.Mutex
+	queues        map[string]*memoryQueue
+	closed        bool
+	maxDeliveries int
+}
+
+type memoryMessage struct {
+	event      events.EventKind
+	payload    []byte
+	deliveries int
+	err        string
+	failedAt   time.Time
+}
+
+type memoryQueue struct {
+	mu      sync.Mutex
+	pending []memoryMessage
+	ready   chan struct{}
+}
+
+func NewInMemory(opts ...Option) *InMemory {
+	o := newOptions(opts)
+	return &InMemory{
+		queues:        make(map[string]*memoryQueue),
+		maxDeliveries: o.maxDeliveries,
+	}
+}
+
+func (b *InMemory) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
+
+func (b *InMemory) Health() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (b *InMemory) DeclareQueue(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, name := range []string{name, DeadLetterQueue(name)} {
+		if _, ok := b.queues[name]; !ok {
+			b.queues[name] = &memoryQueue{ready: make(chan struct{}, 1)}
+		}
+	}
+	return nil
+}
+
+func (b *InMemory) queue(name string) (*memoryQueue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return nil, fmt.Errorf("queue %s is not declared", name)
+	}
+	return q, nil
+}
+
+func (b *InMemory) Publish(ctx context.Context, queueName string, env *events.Envelope) error {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	q, err := b.queue(queueName)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	q.push(memoryMessage{event: env.Kind, payload: body})
+	return nil
+}
+
+func (b *InMemory) Subscribe(ctx context.Context, queueName string, handler Handler) error {
+	q, err := b.queue(queueName)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+	dlq, err := b.queue(DeadLetterQueue(queueName))
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			msg, ok := q.pop()
+			if !ok {
+				select {
+				case <-ctx.Done():
+					return
+				case <-q.ready:
+					continue
+				}
+			}
+			b.deliver(ctx, queueName, q, dlq, msg, handler)
+		}
+	}()
+
+	return nil
+}
+
+// deliver hands msg to handler. A failed message goes to the back of the
+// queue until it has been delivered maxDeliveries times, then to dlq.
+func (b *InMemory) deliver(ctx context.Context, queueName string, q, dlq *memoryQueue, msg memoryMessage, handler Handler) {
+	msg.deliveries++
+
+	poison, err := handle(ctx, msg.payload, handler)
+	if err == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down, keep the message at the head of the queue for the
+		// next subscriber. The loop stops before taking it again.
+		msg.deliveries--
+		q.unpop(msg)
+		return
+	}
+
+	log.Printf("failed to process %s message from %s (delivery %d of %d): %v", msg.event, queueName, msg.deliveries, b.maxDeliveries, err)
+	if msg.deliveries >= b.maxDeliveries || poison {
+		msg.err = err.Error()
+		msg.failedAt = time.Now().UTC()
+		dlq.push(msg)
+		return
+	}
+	q.push(msg)
+}
+
+func (b *InMemory) DeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error) {
+	dlq, err := b.queue(DeadLetterQueue(queueName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+
+	dlq.mu.Lock()
+	defer dlq.mu.Unlock()
+
+	var letters []DeadLetter
+	for _, msg := range dlq.pending {
+		if len(letters) == limit {
+			break
+		}
+		letters = append(letters, DeadLetter{
+			Queue:      queueName,
+			Event:      msg.event,
+			Payload:    msg.payload,
+			Error:      msg.err,
+			Deliveries: msg.deliveries,
+			FailedAt:   msg.failedAt,
+		})
+	}
+	return letters, nil
+}
+
+func (b *InMemory) Replay(ctx context.Context, queueName string, limit int) (int, error) {
+	q, err := b.queue(queueName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay dead letters: %w", err)
+	}
+	dlq, err := b.queue(DeadLetterQueue(queueName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay dead letters: %w", err)
+	}
+
+	replayed := 0
+	for replayed < limit {
+		msg, ok := dlq.pop()
+		if !ok {
+			break
+		}
+		q.push(memoryMessage{event: msg.event, payload: msg.payload})
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (q *memoryQueue) push(msg memoryMessage) {
+	q.mu.Lock()
+	q.pending = append(q.pending, msg)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// unpop puts msg back at the head of the queue.
+func (q *memoryQueue) unpop(msg memoryMessage) {
+	q.mu.Lock()
+	q.pending = append([]memoryMessage{msg}, q.pending...)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *memoryQueue) pop() (memoryMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return memoryMessage{}, false
+	}
+	msg := q.pending[0]
+	q.pending = q.pending[1:]
+	return msg, true
+}
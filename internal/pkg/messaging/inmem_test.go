@@ -0,0 +1,205 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/pkg/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type received struct {
+	event   events.EventKind
+	payload string
+}
+
+func envelope(t *testing.T, kind events.EventKind, data interface{}) *events.Envelope {
+	t.Helper()
+	env, err := events.NewEnvelope(context.Background(), "test", kind, data)
+	require.NoError(t, err)
+	return env
+}
+
+func TestInMemory_DeliversInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := messaging.NewInMemory()
+	require.NoError(t, b.DeclareQueue(events.DataQueue))
+
+	// Messages published before anyone subscribes wait in the queue.
+	require.NoError(t, b.Publish(ctx, events.DataQueue, envelope(t, events.NEW_REPO_DATA, map[string]int{"n": 1})))
+
+	got := make(chan received, 2)
+	require.NoError(t, b.Subscribe(ctx, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		got <- received{env.Kind, string(env.Data)}
+		return nil
+	}))
+	require.NoError(t, b.Publish(ctx, events.DataQueue, envelope(t, events.NEW_COMMITS_DATA, map[string]int{"n": 2})))
+
+	for _, want := range []received{
+		{events.NEW_REPO_DATA, `{"n":1}`},
+		{events.NEW_COMMITS_DATA, `{"n":2}`},
+	} {
+		select {
+		case msg := <-got:
+			assert.Equal(t, want, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+}
+
+func TestInMemory_UndeclaredQueue(t *testing.T) {
+	b := messaging.NewInMemory()
+	assert.Error(t, b.Publish(context.Background(), "missing", envelope(t, events.NEW_REPO_DATA, nil)))
+
+	require.NoError(t, b.DeclareQueue("missing"))
+	assert.NoError(t, b.Health())
+	b.Close()
+	assert.ErrorIs(t, b.Health(), messaging.ErrClosed)
+	assert.ErrorIs(t, b.Publish(context.Background(), "missing", envelope(t, events.NEW_REPO_DATA, nil)), messaging.ErrClosed)
+}
+
+func TestInMemory_DeadLettersAndReplays(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := messaging.NewInMemory(messaging.WithMaxDeliveries(3))
+	require.NoError(t, b.DeclareQueue(events.DataQueue))
+
+	attempts := make(chan int, 10)
+	n := 0
+	require.NoError(t, b.Subscribe(ctx, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		n++
+		attempts <- n
+		if n <= 3 {
+			return errors.New("boom")
+		}
+		return nil
+	}))
+	env := envelope(t, events.NEW_REPO_DATA, map[string]int{"n": 1})
+	require.NoError(t, b.Publish(ctx, events.DataQueue, env))
+
+	require.Eventually(t, func() bool {
+		letters, err := b.DeadLetters(ctx, events.DataQueue, 10)
+		return err == nil && len(letters) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(t, attempts, 3)
+
+	letters, err := b.DeadLetters(ctx, events.DataQueue, 10)
+	require.NoError(t, err)
+	assert.Equal(t, events.NEW_REPO_DATA, letters[0].Event)
+	dead, err := events.Decode(letters[0].Payload)
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, dead.ID)
+	assert.Equal(t, "boom", letters[0].Error)
+	assert.Equal(t, 3, letters[0].Deliveries)
+
+	replayed, err := b.Replay(ctx, events.DataQueue, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+
+	require.Eventually(t, func() bool { return len(attempts) == 4 }, time.Second, 10*time.Millisecond)
+	letters, err = b.DeadLetters(ctx, events.DataQueue, 10)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestInMemory_DeadLettersUnsupportedVersion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := messaging.NewInMemory()
+	require.NoError(t, b.DeclareQueue(events.DataQueue))
+
+	handled := make(chan struct{}, 1)
+	require.NoError(t, b.Subscribe(ctx, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		handled <- struct{}{}
+		return nil
+	}))
+
+	env := envelope(t, events.NEW_REPO_DATA, map[string]int{"n": 1})
+	env.Version = events.SchemaVersion + 1
+	require.NoError(t, b.Publish(ctx, events.DataQueue, env))
+
+	// Retrying cannot help, the message is dead-lettered on first sight.
+	require.Eventually(t, func() bool {
+		letters, err := b.DeadLetters(ctx, events.DataQueue, 10)
+		return err == nil && len(letters) == 1 && letters[0].Deliveries == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, handled)
+}
+
+func TestInMemory_DeadLettersMalformedData(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := messaging.NewInMemory()
+	require.NoError(t, b.DeclareQueue(events.DataQueue))
+
+	var handled atomic.Int32
+	require.NoError(t, b.Subscribe(ctx, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		handled.Add(1)
+		var data struct{ N int }
+		return env.Unmarshal(&data)
+	}))
+
+	env := envelope(t, events.NEW_REPO_DATA, nil)
+	env.Data = []byte(`"not an object"`)
+	require.NoError(t, b.Publish(ctx, events.DataQueue, env))
+
+	// The handler cannot decode the data, retrying cannot help either.
+	require.Eventually(t, func() bool {
+		letters, err := b.DeadLetters(ctx, events.DataQueue, 10)
+		return err == nil && len(letters) == 1 && letters[0].Deliveries == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), handled.Load())
+}
+
+func TestInMemory_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := messaging.NewInMemory()
+	require.NoError(t, b.DeclareQueue(events.DataQueue))
+	require.NoError(t, b.Publish(context.Background(), events.DataQueue, envelope(t, events.NEW_REPO_DATA, nil)))
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	require.NoError(t, b.Subscribe(ctx, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	<-started
+	cancel()
+
+	// The subscriber stops instead of taking the message again.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The message is left for the next subscriber, with its delivery
+	// uncounted.
+	got := make(chan *events.Envelope, 1)
+	next, stop := context.WithCancel(context.Background())
+	defer stop()
+	require.NoError(t, b.Subscribe(next, events.DataQueue, func(ctx context.Context, env *events.Envelope) error {
+		got <- env
+		return nil
+	}))
+	select {
+	case env := <-got:
+		assert.Equal(t, events.NEW_REPO_DATA, env.Kind)
+	case <-time.After(time.Second):
+		t.Fatal("message lost on shutdown")
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
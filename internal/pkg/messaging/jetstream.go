@@ -0,0 +1,330 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
+)
+
+const (
+	// declareTimeout bounds stream and consumer management calls, which take
+	// no context of their own.
+	declareTimeout = 10 * time.Second
+
+	// ackWait is how long the server waits for a delivered message to be
+	// settled before it hands it out again. A handler running longer keeps
+	// its message by reporting progress every third of it.
+	ackWait = 30 * time.Second
+)
+
+// JetStream is a Broker on NATS JetStream. Each queue is a file backed
+// work queue stream with a single subject of the same name, read by a
+// durable consumer shared by every subscriber. Dead letters are kept in a
+// plain stream so they can be looked at without being consumed.
+type JetStream struct {
+	conn          *nats.Conn
+	js            jetstream.JetStream
+	retry         *retry.Policy
+	maxDeliveries int
+}
+
+func NewJetStream(url string, opts ...Option) (*JetStream, error) {
+	// The client reconnects on its own and buffers publishes meanwhile, keep
+	// it trying for as long as the process runs.
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+
+	o := newOptions(opts)
+	return &JetStream{
+		conn:          conn,
+		js:            js,
+		retry:         o.retry,
+		maxDeliveries: o.maxDeliveries,
+	}, nil
+}
+
+func (b *JetStream) Close() {
+	b.conn.Close()
+}
+
+// Health returns ErrDisconnected while the client is reconnecting.
+func (b *JetStream) Health() error {
+	switch status := b.conn.Status(); status {
+	case nats.CONNECTED:
+		return nil
+	case nats.CLOSED:
+		return ErrClosed
+	default:
+		return fmt.Errorf("%w: %s", ErrDisconnected, status)
+	}
+}
+
+func (b *JetStream) DeclareQueue(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), declareTimeout)
+	defer cancel()
+
+	_, err := b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      name,
+		Subjects:  []string{name},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare stream: %w", err)
+	}
+
+	dlq := DeadLetterQueue(name)
+	_, err = b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      dlq,
+		Subjects:  []string{dlq},
+		Retention: jetstream.LimitsPolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter stream: %w", err)
+	}
+	return nil
+}
+
+func (b *JetStream) Publish(ctx context.Context, queueName string, env *events.Envelope) error {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	msg := nats.NewMsg(queueName)
+	msg.Data = body
+	msg.Header.Set(headerEventKind, string(env.Kind))
+	// The server drops a retried publish it has already stored.
+	msg.Header.Set(nats.MsgIdHdr, env.ID.String())
+
+	if err := b.publish(ctx, msg); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+func (b *JetStream) publish(ctx context.Context, msg *nats.Msg) error {
+	return b.retry.Do(ctx, classifyJetStreamError, func(ctx context.Context) error {
+		_, err := b.js.PublishMsg(ctx, msg)
+		return err
+	})
+}
+
+func (b *JetStream) Subscribe(ctx context.Context, queueName string, handler Handler) error {
+	declareCtx, cancel := context.WithTimeout(ctx, declareTimeout)
+	defer cancel()
+
+	// The server stops delivering one attempt after the last one deliver
+	// dead-letters on, so a message whose handler never gets to settle it,
+	// e.g. because the process crashes, does not loop forever.
+	consumer, err := b.js.CreateOrUpdateConsumer(declareCtx, queueName, jetstream.ConsumerConfig{
+		Durable:    queueName,
+		AckPolicy:  jetstream.AckExplicitPolicy,
+		AckWait:    ackWait,
+		MaxDeliver: b.maxDeliveries + 1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		b.deliver(ctx, queueName, msg, handler)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start consuming: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		consumeCtx.Stop()
+	}()
+
+	return nil
+}
+
+// deliver hands msg to handler and settles it. The server counts deliveries,
+// a failed message is redelivered after a delay growing with each attempt.
+func (b *JetStream) deliver(ctx context.Context, queueName string, msg jetstream.Msg, handler Handler) {
+	deliveries := 1
+	if meta, err := msg.Metadata(); err == nil {
+		deliveries = int(meta.NumDelivered)
+	}
+
+	eventKind := msg.Headers().Get(headerEventKind)
+	stop := inProgress(msg)
+	poison, err := handle(ctx, msg.Data(), handler)
+	stop()
+	if err == nil {
+		msg.Ack()
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down, leave the message to the next consumer.
+		msg.Nak()
+		return
+	}
+
+	log.Printf("failed to process %s message from %s (delivery %d of %d): %v", eventKind, queueName, deliveries, b.maxDeliveries, err)
+	if deliveries >= b.maxDeliveries || poison {
+		b.deadLetter(ctx, queueName, msg, deliveries, err)
+		return
+	}
+	msg.NakWithDelay(time.Duration(deliveries) * time.Second)
+}
+
+// inProgress tells the server msg is still being handled until the returned
+// func is called, so it is not redelivered to another consumer meanwhile.
+func inProgress(msg jetstream.Msg) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ackWait / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					log.Printf("failed to extend the ack deadline of a message: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (b *JetStream) deadLetter(ctx context.Context, queueName string, msg jetstream.Msg, deliveries int, cause error) {
+	dead := nats.NewMsg(DeadLetterQueue(queueName))
+	dead.Data = msg.Data()
+	for k, v := range msg.Headers() {
+		dead.Header[k] = v
+	}
+	// A message dead-lettered again after a replay must not be dropped as
+	// a duplicate.
+	dead.Header.Del(nats.MsgIdHdr)
+	dead.Header.Set(headerDeliveries, strconv.Itoa(deliveries))
+	dead.Header.Set(headerError, cause.Error())
+	dead.Header.Set(headerFailedAt, time.Now().UTC().Format(time.RFC3339Nano))
+
+	// Publishing is retried with backoff, which can outlast ackWait.
+	stop := inProgress(msg)
+	err := b.publish(ctx, dead)
+	stop()
+	if err != nil {
+		log.Printf("failed to dead-letter message from %s, redelivering it: %v", queueName, err)
+		msg.Nak()
+		return
+	}
+	msg.Term()
+}
+
+func (b *JetStream) DeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := b.eachDeadLetter(ctx, queueName, limit, func(stream jetstream.Stream, raw *jetstream.RawStreamMsg) error {
+		letters = append(letters, natsDeadLetter(queueName, raw))
+		return nil
+	})
+	return letters, err
+}
+
+func (b *JetStream) Replay(ctx context.Context, queueName string, limit int) (int, error) {
+	replayed := 0
+	err := b.eachDeadLetter(ctx, queueName, limit, func(stream jetstream.Stream, raw *jetstream.RawStreamMsg) error {
+		msg := nats.NewMsg(queueName)
+		msg.Data = raw.Data
+		msg.Header.Set(headerEventKind, raw.Header.Get(headerEventKind))
+		if err := b.publish(ctx, msg); err != nil {
+			return fmt.Errorf("failed to replay message: %w", err)
+		}
+		if err := stream.DeleteMsg(ctx, raw.Sequence); err != nil {
+			return fmt.Errorf("failed to remove replayed message: %w", err)
+		}
+		replayed++
+		return nil
+	})
+	return replayed, err
+}
+
+// eachDeadLetter calls fn with up to limit dead letters of queueName, oldest
+// first.
+func (b *JetStream) eachDeadLetter(ctx context.Context, queueName string, limit int, fn func(jetstream.Stream, *jetstream.RawStreamMsg) error) error {
+	stream, err := b.js.Stream(ctx, DeadLetterQueue(queueName))
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter stream: %w", err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read dead-letter stream: %w", err)
+	}
+
+	seen := 0
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && seen < limit && info.State.Msgs > 0; seq++ {
+		raw, err := stream.GetMsg(ctx, seq)
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read dead letter %d: %w", seq, err)
+		}
+		if err := fn(stream, raw); err != nil {
+			return err
+		}
+		seen++
+	}
+	return nil
+}
+
+func natsDeadLetter(queueName string, raw *jetstream.RawStreamMsg) DeadLetter {
+	deliveries, _ := strconv.Atoi(raw.Header.Get(headerDeliveries))
+	failedAt, err := time.Parse(time.RFC3339Nano, raw.Header.Get(headerFailedAt))
+	if err != nil {
+		failedAt = raw.Time
+	}
+	return DeadLetter{
+		Queue:      queueName,
+		Event:      events.EventKind(raw.Header.Get(headerEventKind)),
+		Payload:    raw.Data,
+		Error:      raw.Header.Get(headerError),
+		Deliveries: deliveries,
+		FailedAt:   failedAt,
+	}
+}
+
+// classifyJetStreamError retries publishes that timed out or found no stream
+// to take them, which happens while the server restarts or elects a leader.
+func classifyJetStreamError(err error) (bool, time.Duration) {
+	switch {
+	case errors.Is(err, nats.ErrTimeout),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, nats.ErrNoResponders),
+		errors.Is(err, jetstream.ErrNoStreamResponse):
+		return true, 0
+	}
+	return false, 0
+}
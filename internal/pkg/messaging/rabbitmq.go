@@ -0,0 +1,519 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/events"
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errPublishNacked = errors.New("message was not confirmed by the server")
+
+// rabbitPrefetch bounds the unacknowledged messages the server hands to a
+// consumer. Each consumer handles one message at a time, the rest wait on the
+// server where other consumers can take them.
+const rabbitPrefetch = 10
+
+// RabbitMQ is a Broker on RabbitMQ, where each queue is a durable queue
+// published to through the default exchange.
+//
+// When the connection or its channel closes, RabbitMQ dials again with
+// backoff, redeclares the queues and resubscribes the consumers declared so
+// far. Publishes fail with ErrDisconnected until it is back, which the retry
+// policy treats as worth retrying.
+type RabbitMQ struct {
+	url           string
+	retry         *retry.Policy
+	reconnect     *retry.Policy
+	maxDeliveries int
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	queues  []string
+	subs    []*rabbitSubscription
+	closed  bool
+	done    chan struct{}
+}
+
+type rabbitSubscription struct {
+	ctx     context.Context
+	queue   string
+	handler Handler
+}
+
+func NewRabbitMQ(url string, opts ...Option) (*RabbitMQ, error) {
+	conn, ch, err := dialRabbitMQ(url)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	c := &RabbitMQ{
+		url:           url,
+		retry:         o.retry,
+		reconnect:     reconnectPolicy(o.retry),
+		maxDeliveries: o.maxDeliveries,
+		conn:          conn,
+		channel:       ch,
+		done:          make(chan struct{}),
+	}
+	go c.watch(conn, ch)
+	return c, nil
+}
+
+// reconnectPolicy paces reconnection attempts like retried publishes, and
+// never gives up.
+func reconnectPolicy(p *retry.Policy) *retry.Policy {
+	if p == nil {
+		return retry.NewPolicy(0, time.Second, 30*time.Second)
+	}
+	return retry.NewPolicy(0, p.Initial, p.Max)
+}
+
+// dialRabbitMQ opens a connection and a channel in confirm mode, so that a
+// publish only succeeds once the server has taken the message.
+func dialRabbitMQ(url string) (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	return conn, ch, nil
+}
+
+func (c *RabbitMQ) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	if c.conn != nil {
+		c.channel.Close()
+		c.conn.Close()
+	}
+}
+
+// Health returns ErrDisconnected while the connection is down.
+func (c *RabbitMQ) Health() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if c.conn == nil || c.conn.IsClosed() {
+		return ErrDisconnected
+	}
+	return nil
+}
+
+// watch waits for conn or ch to close and replaces them, until Close is
+// called.
+func (c *RabbitMQ) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	for {
+		var reason *amqp.Error
+		select {
+		case reason = <-conn.NotifyClose(make(chan *amqp.Error, 1)):
+		case reason = <-ch.NotifyClose(make(chan *amqp.Error, 1)):
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		c.conn, c.channel = nil, nil
+		c.mu.Unlock()
+
+		// Only the channel may have failed, drop the connection with it.
+		conn.Close()
+		log.Printf("lost connection to RabbitMQ: %v", reason)
+
+		var ok bool
+		conn, ch, ok = c.redial()
+		if !ok {
+			return
+		}
+	}
+}
+
+// redial connects again with backoff and restores the queues and consumers.
+// It gives up only once the client is closed.
+func (c *RabbitMQ) redial() (*amqp.Connection, *amqp.Channel, bool) {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-c.done:
+			return nil, nil, false
+		case <-time.After(c.reconnect.Backoff(attempt)):
+		}
+
+		conn, ch, err := dialRabbitMQ(c.url)
+		if err != nil {
+			log.Printf("failed to reconnect to RabbitMQ (attempt %d): %v", attempt+1, err)
+			continue
+		}
+
+		closed, err := c.restore(conn, ch)
+		if closed {
+			conn.Close()
+			return nil, nil, false
+		}
+		if err != nil {
+			log.Printf("failed to restore RabbitMQ consumers (attempt %d): %v", attempt+1, err)
+			conn.Close()
+			continue
+		}
+
+		log.Printf("reconnected to RabbitMQ after %d attempts", attempt+1)
+		return conn, ch, true
+	}
+}
+
+// restore redeclares the queues and resubscribes the live consumers on ch,
+// then makes it the channel publishes go to.
+func (c *RabbitMQ) restore(conn *amqp.Connection, ch *amqp.Channel) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return true, nil
+	}
+
+	for _, queue := range c.queues {
+		if err := declareRabbitMQQueue(ch, queue); err != nil {
+			return false, err
+		}
+	}
+
+	var live []*rabbitSubscription
+	for _, sub := range c.subs {
+		if sub.ctx.Err() != nil {
+			continue
+		}
+		if err := c.consume(ch, sub); err != nil {
+			return false, err
+		}
+		live = append(live, sub)
+	}
+	c.subs = live
+
+	c.conn, c.channel = conn, ch
+	return false, nil
+}
+
+func (c *RabbitMQ) DeclareQueue(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel == nil {
+		return fmt.Errorf("failed to declare queue: %w", ErrDisconnected)
+	}
+	if err := declareRabbitMQQueue(c.channel, name); err != nil {
+		return err
+	}
+	if !slices.Contains(c.queues, name) {
+		c.queues = append(c.queues, name)
+	}
+	return nil
+}
+
+func declareRabbitMQQueue(ch *amqp.Channel, name string) error {
+	for _, queue := range []string{name, DeadLetterQueue(name)} {
+		_, err := ch.QueueDeclare(
+			queue,
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare queue: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *RabbitMQ) Publish(ctx context.Context, queueName string, env *events.Envelope) error {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := c.publish(ctx, queueName, body, amqp.Table{headerEventKind: string(env.Kind)}); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+func (c *RabbitMQ) publish(ctx context.Context, queueName string, body []byte, headers amqp.Table) error {
+	return c.retry.Do(ctx, classifyRabbitMQError, func(ctx context.Context) error {
+		c.mu.Lock()
+		ch := c.channel
+		c.mu.Unlock()
+		if ch == nil {
+			return ErrDisconnected
+		}
+
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(
+			ctx,
+			"",
+			queueName,
+			false,
+			false,
+			amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Body:         body,
+				Headers:      headers,
+			})
+		if err != nil {
+			return err
+		}
+
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !acked {
+			return errPublishNacked
+		}
+		return nil
+	})
+}
+
+func (c *RabbitMQ) Subscribe(ctx context.Context, queueName string, handler Handler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel == nil {
+		return fmt.Errorf("failed to register a consumer: %w", ErrDisconnected)
+	}
+
+	sub := &rabbitSubscription{ctx: ctx, queue: queueName, handler: handler}
+	if err := c.consume(c.channel, sub); err != nil {
+		return err
+	}
+	c.subs = append(c.subs, sub)
+	return nil
+}
+
+// consume starts handing the messages of sub's queue on ch to its handler.
+// Deliveries stop when ch closes, and start again once restore resubscribes.
+func (c *RabbitMQ) consume(ch *amqp.Channel, sub *rabbitSubscription) error {
+	// The prefetch applies to consumers started on ch after it is set, so it
+	// is set for each of them, on every channel restore opens.
+	if err := ch.Qos(rabbitPrefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set the prefetch count: %w", err)
+	}
+
+	msgs, err := ch.ConsumeWithContext(sub.ctx,
+		sub.queue,
+		"",
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	go func() {
+		for msg := range msgs {
+			c.deliver(sub.ctx, sub.queue, msg, sub.handler)
+		}
+	}()
+
+	return nil
+}
+
+// deliver hands msg to handler and settles it. Classic queues do not count
+// redeliveries, so a failed message is published again at the back of the
+// queue with its deliveries counted in a header, and the original is acked.
+func (c *RabbitMQ) deliver(ctx context.Context, queueName string, msg amqp.Delivery, handler Handler) {
+	deliveries := tableInt(msg.Headers, headerDeliveries) + 1
+
+	eventKind, _ := msg.Headers[headerEventKind].(string)
+	poison, err := handle(ctx, msg.Body, handler)
+	if err == nil {
+		msg.Ack(false)
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down, leave the message to the next consumer.
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("failed to process %s message from %s (delivery %d of %d): %v", eventKind, queueName, deliveries, c.maxDeliveries, err)
+	c.settleFailed(ctx, queueName, msg, deliveries, err, deliveries >= c.maxDeliveries || poison)
+}
+
+func (c *RabbitMQ) settleFailed(ctx context.Context, queueName string, msg amqp.Delivery, deliveries int, cause error, dead bool) {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[headerDeliveries] = int64(deliveries)
+
+	target := queueName
+	if dead {
+		target = DeadLetterQueue(queueName)
+		headers[headerError] = cause.Error()
+		headers[headerFailedAt] = time.Now().UTC()
+	}
+
+	if err := c.publish(ctx, target, msg.Body, headers); err != nil {
+		log.Printf("failed to move message to %s, returning it to %s: %v", target, queueName, err)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+}
+
+func (c *RabbitMQ) DeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error) {
+	// Messages taken on a channel of their own go back to the queue
+	// unacknowledged when it closes.
+	ch, err := c.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	var letters []DeadLetter
+	for len(letters) < limit {
+		msg, ok, err := ch.Get(DeadLetterQueue(queueName), false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, rabbitDeadLetter(queueName, msg))
+	}
+	return letters, nil
+}
+
+func (c *RabbitMQ) Replay(ctx context.Context, queueName string, limit int) (int, error) {
+	ch, err := c.openChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	replayed := 0
+	for replayed < limit {
+		msg, ok, err := ch.Get(DeadLetterQueue(queueName), false)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{}
+		if eventKind, ok := msg.Headers[headerEventKind].(string); ok {
+			headers[headerEventKind] = eventKind
+		}
+		if err := c.publish(ctx, queueName, msg.Body, headers); err != nil {
+			return replayed, fmt.Errorf("failed to replay message: %w", err)
+		}
+		if err := msg.Ack(false); err != nil {
+			return replayed, fmt.Errorf("failed to remove replayed message: %w", err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// openChannel opens a channel next to the one publishes go through.
+func (c *RabbitMQ) openChannel() (*amqp.Channel, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("failed to open a channel: %w", ErrDisconnected)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	return ch, nil
+}
+
+func rabbitDeadLetter(queueName string, msg amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		Queue:      queueName,
+		Payload:    msg.Body,
+		Deliveries: tableInt(msg.Headers, headerDeliveries),
+	}
+	eventKind, _ := msg.Headers[headerEventKind].(string)
+	letter.Event = events.EventKind(eventKind)
+	letter.Error, _ = msg.Headers[headerError].(string)
+	letter.FailedAt, _ = msg.Headers[headerFailedAt].(time.Time)
+	return letter
+}
+
+// tableInt reads an integer header, which the server may hand back in any
+// integer width.
+func tableInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// classifyRabbitMQError retries broker errors the server flagged as
+// recoverable, network failures, and publishes that met a closed or
+// recovering connection or were refused by the server.
+func classifyRabbitMQError(err error) (bool, time.Duration) {
+	if errors.Is(err, ErrDisconnected) || errors.Is(err, amqp.ErrClosed) || errors.Is(err, errPublishNacked) {
+		return true, 0
+	}
+
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) {
+		return amqpErr.Recover, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, 0
+	}
+
+	return false, 0
+}
@@ -0,0 +1,127 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Clock abstracts time so backoff can be tested without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Classifier decides whether err is worth retrying. A positive wait overrides
+// the computed backoff, for instance when the server said when to come back.
+type Classifier func(err error) (retryable bool, wait time.Duration)
+
+// Policy retries an operation with exponential backoff and jitter. A nil
+// Policy runs the operation exactly once.
+type Policy struct {
+	MaxRetries int
+	Initial    time.Duration
+	Max        time.Duration
+	Clock      Clock
+}
+
+func NewPolicy(maxRetries int, initial, max time.Duration) *Policy {
+	return &Policy{
+		MaxRetries: maxRetries,
+		Initial:    initial,
+		Max:        max,
+		Clock:      realClock{},
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as fatal regardless of the classifier.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do runs op until it succeeds, fails with an error classify rejects, the
+// retries are exhausted or ctx is done. A nil classify retries every error.
+func (p *Policy) Do(ctx context.Context, classify Classifier, op func(context.Context) error) error {
+	if p == nil {
+		return op(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+
+		retryable, wait := true, time.Duration(0)
+		if classify != nil {
+			retryable, wait = classify(err)
+		}
+		if !retryable {
+			return err
+		}
+		if attempt >= p.MaxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+
+		if wait <= 0 {
+			wait = p.Backoff(attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-p.clock().After(wait):
+		}
+	}
+}
+
+// Backoff returns the delay before retry number attempt, counting from zero.
+// The delay doubles on every attempt up to Max, and the upper half of it is
+// jittered so that clients failing together do not retry together.
+func (p *Policy) Backoff(attempt int) time.Duration {
+	d := p.Initial
+	for i := 0; i < attempt && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+func (p *Policy) clock() Clock {
+	if p.Clock == nil {
+		return realClock{}
+	}
+	return p.Clock
+}
@@ -0,0 +1,149 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/noelukwa/git-explorer/internal/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock fires every timer immediately and records what was asked for.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+var errTransient = errors.New("transient")
+
+func newPolicy(maxRetries int) (*retry.Policy, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := retry.NewPolicy(maxRetries, time.Second, 8*time.Second)
+	p.Clock = clock
+	return p, clock
+}
+
+func TestDo_RetriesUntilSuccess(t *testing.T) {
+	p, clock := newPolicy(5)
+
+	calls := 0
+	err := p.Do(context.Background(), nil, func(ctx context.Context) error {
+		calls++
+		if calls < 4 {
+			return errTransient
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	require.Len(t, clock.waits, 3)
+
+	// Each wait is jittered within the upper half of the exponential step.
+	for i, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		assert.GreaterOrEqual(t, clock.waits[i], base/2)
+		assert.LessOrEqual(t, clock.waits[i], base)
+	}
+}
+
+func TestDo_GivesUp(t *testing.T) {
+	p, clock := newPolicy(2)
+
+	calls := 0
+	err := p.Do(context.Background(), nil, func(ctx context.Context) error {
+		calls++
+		return errTransient
+	})
+	assert.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 3, calls)
+	assert.Len(t, clock.waits, 2)
+}
+
+func TestDo_FatalErrors(t *testing.T) {
+	p, clock := newPolicy(5)
+	errFatal := errors.New("not found")
+
+	classify := func(err error) (bool, time.Duration) {
+		return !errors.Is(err, errFatal), 0
+	}
+
+	calls := 0
+	err := p.Do(context.Background(), classify, func(ctx context.Context) error {
+		calls++
+		return errFatal
+	})
+	assert.ErrorIs(t, err, errFatal)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = p.Do(context.Background(), nil, func(ctx context.Context) error {
+		calls++
+		return retry.Permanent(errTransient)
+	})
+	assert.Equal(t, errTransient, err)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, clock.waits)
+}
+
+func TestDo_HonorsServerWait(t *testing.T) {
+	p, clock := newPolicy(1)
+
+	classify := func(err error) (bool, time.Duration) {
+		return true, 42 * time.Second
+	}
+
+	calls := 0
+	err := p.Do(context.Background(), classify, func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return errTransient
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{42 * time.Second}, clock.waits)
+}
+
+func TestDo_StopsOnCancel(t *testing.T) {
+	p, _ := newPolicy(5)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := p.Do(ctx, nil, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errTransient
+	})
+	assert.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 1, calls)
+}
+
+func TestBackoff_CapsAtMax(t *testing.T) {
+	p, _ := newPolicy(10)
+	for attempt := 0; attempt < 64; attempt++ {
+		assert.LessOrEqual(t, p.Backoff(attempt), 8*time.Second)
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var p *retry.Policy
+	calls := 0
+	err := p.Do(context.Background(), nil, func(ctx context.Context) error {
+		calls++
+		return errTransient
+	})
+	assert.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 1, calls)
+}